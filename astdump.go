@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+// astPrinter is a parser transformer that changes nothing: it writes the
+// parsed document as an indented tree for --print-ast, one node per line
+// with its attributes, source line range (block nodes) and text (Text nodes).
+type astPrinter struct {
+	w io.Writer
+}
+
+func (p *astPrinter) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+	var b strings.Builder
+	depth := 0
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			depth--
+			return ast.WalkContinue, nil
+		}
+		b.WriteString(strings.Repeat("  ", depth))
+		b.WriteString(n.Kind().String())
+		for _, attr := range n.Attributes() {
+			value := attr.Value
+			if v, ok := value.([]byte); ok {
+				value = string(v)
+			}
+			fmt.Fprintf(&b, " %s=%v", attr.Name, value)
+		}
+		if n.Type() == ast.TypeBlock && n.Lines().Len() > 0 {
+			first, last := n.Lines().At(0), n.Lines().At(n.Lines().Len()-1)
+			fmt.Fprintf(&b, " [lines %d-%d]", lineOf(source, first.Start), lineOf(source, last.Stop-1))
+		}
+		if t, ok := n.(*ast.Text); ok {
+			fmt.Fprintf(&b, " %q", t.Segment.Value(source))
+		}
+		b.WriteByte('\n')
+		depth++
+		return ast.WalkContinue, nil
+	})
+	// One write per document so concurrent renders don't interleave.
+	io.WriteString(p.w, b.String())
+}
+
+// lineOf returns the 1-based line number of byte offset off in source.
+func lineOf(source []byte, off int) int {
+	if off > len(source) {
+		off = len(source)
+	}
+	if off < 0 {
+		off = 0
+	}
+	return bytes.Count(source[:off], []byte("\n")) + 1
+}
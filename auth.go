@@ -0,0 +1,71 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// authRealm is the realm browsers show in their login prompt for --auth.
+const authRealm = "livemd"
+
+// parseAuth splits an --auth "user:pass" value. The password may contain
+// colons; the user name may not be empty.
+func parseAuth(spec string) (user, password string, err error) {
+	user, password, ok := strings.Cut(spec, ":")
+	if !ok || user == "" {
+		return "", "", errors.New("want user:password") // spec isn't echoed, it's a secret
+	}
+	return user, password, nil
+}
+
+// requireAuth answers every request without the --auth credentials with 401
+// and a Basic challenge, before next sees it, so WebSocket and Server-Sent
+// Events connections are refused before they are upgraded.
+func requireAuth(next http.Handler, opts *ServerOptions) http.Handler {
+	if opts.AuthUser == "" {
+		return next
+	}
+	// Comparing hashes keeps the comparison constant-time even when the
+	// lengths differ.
+	wantUser := sha256.Sum256([]byte(opts.AuthUser))
+	wantPassword := sha256.Sum256([]byte(opts.AuthPassword))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		gotUser := sha256.Sum256([]byte(user))
+		gotPassword := sha256.Sum256([]byte(password))
+		userOK := subtle.ConstantTimeCompare(gotUser[:], wantUser[:])
+		passwordOK := subtle.ConstantTimeCompare(gotPassword[:], wantPassword[:])
+		if !ok || userOK&passwordOK != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="`+authRealm+`"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authTransport adds the LIVEMD_AUTH credentials to the CLI's requests, for
+// a daemon started with --auth. The lock file is world-readable, so the
+// credentials can't be passed through it.
+type authTransport struct {
+	http.RoundTripper
+}
+
+func (t authTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	spec, ok := os.LookupEnv("LIVEMD_AUTH")
+	if !ok {
+		return t.RoundTripper.RoundTrip(r)
+	}
+	user, password, err := parseAuth(spec)
+	if err != nil {
+		return nil, fmt.Errorf("LIVEMD_AUTH: %v", err)
+	}
+	r = r.Clone(r.Context())
+	r.SetBasicAuth(user, password)
+	return t.RoundTripper.RoundTrip(r)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/base64"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestAuthGuardsEveryRoute(t *testing.T) {
+	opts := testOptions()
+	opts.AuthUser, opts.AuthPassword = "user", "secret"
+	s, ts := startTestServer(t, opts)
+	doc := filepath.Join(t.TempDir(), "doc.md")
+	if err := os.WriteFile(doc, []byte("# Doc\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.hub.AddFile(doc); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"/", "/api/content", "/events"} {
+		resp, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized || resp.Header.Get("WWW-Authenticate") == "" {
+			t.Errorf("GET %s without credentials: %s, want 401 with a challenge", path, resp.Status)
+		}
+
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+path, nil)
+		req.SetBasicAuth("user", "wrong")
+		resp, err = http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("GET %s with a wrong password: %s, want 401", path, resp.Status)
+		}
+
+		req, _ = http.NewRequest(http.MethodGet, ts.URL+path, nil)
+		req.SetBasicAuth("user", "secret")
+		resp, err = http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close() // ends the /events stream
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("GET %s with credentials: %s, want 200", path, resp.Status)
+		}
+	}
+
+	wsURL := "ws" + strings.TrimPrefix(ts.URL, "http") + opts.WSPath
+	_, resp, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("WebSocket upgrade without credentials: %v, want 401", err)
+	}
+	header := http.Header{"Authorization": {"Basic " + base64.StdEncoding.EncodeToString([]byte("user:secret"))}}
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, header)
+	if err != nil {
+		t.Fatalf("WebSocket upgrade with credentials: %v", err)
+	}
+	conn.Close()
+}
+
+func TestIsLoopbackHost(t *testing.T) {
+	for host, want := range map[string]bool{
+		"localhost":   true,
+		"127.0.0.1":   true,
+		"::1":         true,
+		"192.168.1.5": false,
+		"example.com": false,
+		"":            false,
+	} {
+		if got := isLoopbackHost(host); got != want {
+			t.Errorf("isLoopbackHost(%q) = %v, want %v", host, got, want)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// renderCache keeps rendered markdown on disk (--cache-dir) so a restarted
+// daemon doesn't re-render unchanged files. Entries are keyed by the SHA-256
+// of the document source: <hash>.html holds the rendered HTML and
+// <hash>.json a cacheMeta sidecar. An entry written under different renderer
+// options is a miss and gets overwritten.
+type renderCache struct {
+	dir     string
+	maxSize int64 // total bytes of HTML to keep; 0 = unlimited
+
+	mu      sync.Mutex
+	entries map[string]cacheMeta
+	size    int64
+}
+
+// cacheMeta is the sidecar stored next to each cached render.
+type cacheMeta struct {
+	Source     string    `json:"source"`     // path the entry was rendered from
+	RenderedAt time.Time `json:"renderedAt"` // eviction removes the oldest first
+	Options    string    `json:"options"`    // Renderer.optionsHash at render time
+	Size       int64     `json:"size"`       // bytes of HTML
+}
+
+// openRenderCache indexes the entries already in dir. Sidecars whose HTML is
+// missing, and files it can't parse, are ignored: the cache is best-effort.
+func openRenderCache(dir string, maxSize int64) *renderCache {
+	c := &renderCache{dir: dir, maxSize: maxSize, entries: make(map[string]cacheMeta)}
+	sidecars, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	for _, sidecar := range sidecars {
+		data, err := os.ReadFile(sidecar)
+		if err != nil {
+			continue
+		}
+		var meta cacheMeta
+		if json.Unmarshal(data, &meta) != nil {
+			continue
+		}
+		hash := strings.TrimSuffix(filepath.Base(sidecar), ".json")
+		if _, err := os.Stat(c.htmlPath(hash)); err != nil {
+			continue
+		}
+		c.entries[hash] = meta
+		c.size += meta.Size
+	}
+	c.mu.Lock()
+	c.evict()
+	c.mu.Unlock()
+	return c
+}
+
+// contentHash is the cache key of a document's source.
+func contentHash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *renderCache) htmlPath(hash string) string {
+	return filepath.Join(c.dir, hash+".html")
+}
+
+func (c *renderCache) metaPath(hash string) string {
+	return filepath.Join(c.dir, hash+".json")
+}
+
+// Get returns the cached render of the source with this hash, if it was
+// rendered with the same options.
+func (c *renderCache) Get(hash, options string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	meta, ok := c.entries[hash]
+	if !ok || meta.Options != options {
+		return "", false
+	}
+	data, err := os.ReadFile(c.htmlPath(hash))
+	if err != nil {
+		c.remove(hash)
+		return "", false
+	}
+	return string(data), true
+}
+
+// Put stores a render, then evicts the oldest entries beyond maxSize.
+// Write errors only mean the entry isn't cached.
+func (c *renderCache) Put(hash, options, source, html string) {
+	meta := cacheMeta{
+		Source:     source,
+		RenderedAt: time.Now(),
+		Options:    options,
+		Size:       int64(len(html)),
+	}
+	data, _ := json.MarshalIndent(meta, "", "  ")
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if old, ok := c.entries[hash]; ok {
+		c.size -= old.Size
+		delete(c.entries, hash)
+	}
+	if os.WriteFile(c.htmlPath(hash), []byte(html), 0644) != nil ||
+		os.WriteFile(c.metaPath(hash), data, 0644) != nil {
+		os.Remove(c.htmlPath(hash))
+		return
+	}
+	c.entries[hash] = meta
+	c.size += meta.Size
+	c.evict()
+}
+
+// evict drops the oldest entries until the cache fits in maxSize.
+// Callers hold c.mu.
+func (c *renderCache) evict() {
+	if c.maxSize <= 0 || c.size <= c.maxSize {
+		return
+	}
+	hashes := make([]string, 0, len(c.entries))
+	for hash := range c.entries {
+		hashes = append(hashes, hash)
+	}
+	sort.Slice(hashes, func(i, j int) bool {
+		return c.entries[hashes[i]].RenderedAt.Before(c.entries[hashes[j]].RenderedAt)
+	})
+	for _, hash := range hashes {
+		if c.size <= c.maxSize {
+			break
+		}
+		c.remove(hash)
+	}
+}
+
+// remove deletes an entry and its files. Callers hold c.mu.
+func (c *renderCache) remove(hash string) {
+	c.size -= c.entries[hash].Size
+	delete(c.entries, hash)
+	os.Remove(c.htmlPath(hash))
+	os.Remove(c.metaPath(hash))
+}
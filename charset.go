@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// charsetCommentPattern finds an in-document declaration such as
+// <!-- charset: windows-1252 --> for --doc-charset auto.
+var charsetCommentPattern = regexp.MustCompile(`(?i)<!--\s*(?:charset|encoding)\s*[:=]\s*"?([\w.:-]+)"?\s*-->`)
+
+// charsetSniffLen bounds how far into a document auto-detection looks for a
+// charset comment, like the 1024-byte prescan browsers do for <meta charset>.
+const charsetSniffLen = 1024
+
+// docCharset converts text documents to UTF-8 before rendering
+// (--doc-charset). A nil *docCharset leaves content untouched.
+type docCharset struct {
+	enc  encoding.Encoding // fixed input encoding; nil when auto
+	auto bool
+}
+
+// parseDocCharset resolves a --doc-charset value: "auto", or any WHATWG
+// encoding name or label (utf-8, windows-1252, iso-8859-1, gb2312, ...).
+func parseDocCharset(name string) (*docCharset, error) {
+	if strings.EqualFold(name, "auto") {
+		return &docCharset{auto: true}, nil
+	}
+	enc, err := htmlindex.Get(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown charset %q", name)
+	}
+	return &docCharset{enc: enc}, nil
+}
+
+// decode returns content as UTF-8.
+func (c *docCharset) decode(content []byte) ([]byte, error) {
+	if c == nil {
+		return content, nil
+	}
+	enc := c.enc
+	if c.auto {
+		enc = detectCharset(content)
+		if enc == nil {
+			return content, nil
+		}
+	}
+	out, _, err := transform.Bytes(enc.NewDecoder(), content)
+	return out, err
+}
+
+// detectCharset picks an encoding from a byte order mark or a charset
+// comment near the top of the document. It returns nil when neither is
+// present (content is then treated as UTF-8, as without --doc-charset).
+func detectCharset(content []byte) encoding.Encoding {
+	switch {
+	case bytes.HasPrefix(content, []byte{0xEF, 0xBB, 0xBF}):
+		return unicode.UTF8BOM
+	case bytes.HasPrefix(content, []byte{0xFF, 0xFE}):
+		return unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM)
+	case bytes.HasPrefix(content, []byte{0xFE, 0xFF}):
+		return unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM)
+	}
+
+	head := content
+	if len(head) > charsetSniffLen {
+		head = head[:charsetSniffLen]
+	}
+	if m := charsetCommentPattern.FindSubmatch(head); m != nil {
+		if enc, err := htmlindex.Get(string(m[1])); err == nil {
+			return enc
+		}
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// defaultConfigFile is read by `livemd start` from the current directory
+// when neither --config nor LIVEMD_CONFIG names another file.
+const defaultConfigFile = ".livemd.toml"
+
+// applyStartDefaults presets the `livemd start` flags in fs from a TOML config
+// file, then from LIVEMD_* environment variables (LIVEMD_HIGHLIGHT_THEME_LIGHT
+// for --highlight-theme-light), so that the command line, parsed afterwards,
+// overrides both. Config keys are flag names without the dashes:
+//
+//	port = 3001
+//	toc = true
+//	highlight-language-map = ["shell-session:bash", "console:bash"]
+//
+// --detach and --config only work on the command line.
+func applyStartDefaults(fs *flag.FlagSet, args []string) error {
+	path, explicit := configFileArg(args)
+	if !explicit {
+		path, explicit = os.LookupEnv("LIVEMD_CONFIG")
+	}
+	if !explicit {
+		path = defaultConfigFile
+	}
+	if _, err := os.Stat(path); err == nil || explicit {
+		if err := loadConfigFile(fs, path); err != nil {
+			return err
+		}
+	}
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || f.Name == "detach" || f.Name == "config" {
+			return
+		}
+		name := "LIVEMD_" + strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_"))
+		if value, ok := os.LookupEnv(name); ok {
+			if setErr := fs.Set(f.Name, value); setErr != nil {
+				err = fmt.Errorf("invalid value %q for %s: %v", value, name, setErr)
+			}
+		}
+	})
+	return err
+}
+
+// configFileArg finds the --config value in args, which haven't been parsed
+// yet when the config file has to be read.
+func configFileArg(args []string) (string, bool) {
+	for i, arg := range args {
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || name != "config" {
+			continue
+		}
+		if hasValue {
+			return value, true
+		}
+		if i+1 < len(args) {
+			return args[i+1], true
+		}
+	}
+	return "", false
+}
+
+// loadConfigFile sets the flags named by the keys of the TOML file at path.
+// Unknown keys are an error; arrays set a repeatable flag once per element.
+func loadConfigFile(fs *flag.FlagSet, path string) error {
+	var config map[string]interface{}
+	if _, err := toml.DecodeFile(path, &config); err != nil {
+		return fmt.Errorf("config %s: %v", path, err)
+	}
+	keys := make([]string, 0, len(config))
+	for key := range config {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if fs.Lookup(key) == nil || key == "detach" || key == "config" {
+			return fmt.Errorf("config %s: unknown option %q", path, key)
+		}
+		values, ok := config[key].([]interface{})
+		if !ok {
+			values = []interface{}{config[key]}
+		}
+		for _, v := range values {
+			value, err := configValue(v)
+			if err != nil {
+				return fmt.Errorf("config %s: %s: %v", path, key, err)
+			}
+			if err := fs.Set(key, value); err != nil {
+				return fmt.Errorf("config %s: invalid value %q for %s: %v", path, value, key, err)
+			}
+		}
+	}
+	return nil
+}
+
+// configValue formats a TOML value the way it would be written as a flag.
+func configValue(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	default:
+		return "", fmt.Errorf("unsupported value %v", v)
+	}
+}
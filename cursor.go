@@ -0,0 +1,84 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+)
+
+// CursorPosition is how far a browser is scrolled into a file, shared with
+// the other browsers by --live-cursor.
+type CursorPosition struct {
+	ClientID  string  `json:"clientID"`
+	Path      string  `json:"path,omitempty"`
+	ScrollPct float64 `json:"scrollPct"`      // 0 = top, 100 = bottom
+	Gone      bool    `json:"gone,omitempty"` // the client disconnected
+}
+
+// cursorMove is a CursorPosition on its way from a client's reader to Run.
+type cursorMove struct {
+	from *Client
+	pos  CursorPosition
+}
+
+// newClientID returns a random identifier for a WebSocket client.
+func newClientID() string {
+	b := make([]byte, 6)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// moveCursor hands a "cursor" message read from c to Run. The client ID is
+// the server's, whatever the browser sent. When Run is behind the move is
+// dropped: the next scroll sends a newer one.
+func (h *Hub) moveCursor(c *Client, data []byte) {
+	var msg Message
+	if json.Unmarshal(data, &msg) != nil || msg.Type != "cursor" || msg.Cursor == nil {
+		return
+	}
+	pos := CursorPosition{ClientID: c.id, Path: msg.Cursor.Path, ScrollPct: msg.Cursor.ScrollPct}
+	if pos.ScrollPct < 0 {
+		pos.ScrollPct = 0
+	} else if pos.ScrollPct > 100 {
+		pos.ScrollPct = 100
+	}
+	select {
+	case h.cursors <- cursorMove{from: c, pos: pos}:
+	default:
+	}
+}
+
+// relayCursor records a client's position and sends it to every other
+// client. Only Run calls it.
+func (h *Hub) relayCursor(move cursorMove) {
+	if !h.clients[move.from] {
+		return // disconnected meanwhile; forgetCursor already ran
+	}
+	h.cursorPos[move.from] = move.pos
+	data, _ := json.Marshal(Message{Type: "cursor", Cursor: &move.pos})
+	h.deliver(data, "", move.from)
+}
+
+// forgetCursor tells the remaining clients that c's cursor is gone. Only Run
+// calls it, after removing c.
+func (h *Hub) forgetCursor(c *Client) {
+	if _, ok := h.cursorPos[c]; !ok {
+		return
+	}
+	delete(h.cursorPos, c)
+	data, _ := json.Marshal(Message{Type: "cursor", Cursor: &CursorPosition{ClientID: c.id, Gone: true}})
+	h.deliver(data, "", nil)
+}
+
+// sendCursors gives a newly connected client everyone's last position.
+func (h *Hub) sendCursors(c *Client) {
+	for _, pos := range h.cursorPos {
+		pos := pos
+		data, _ := json.Marshal(Message{Type: "cursor", Cursor: &pos})
+		select {
+		case c.send <- data:
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// customCSSLink is the <link> to the --css stylesheet for a page's <head>.
+// Its query string changes with the file's mtime, so browsers cache the
+// stylesheet but fetch it again once it has been edited.
+func (s *Server) customCSSLink() string {
+	if s.opts.CustomCSS == "" {
+		return ""
+	}
+	var version int64
+	if info, err := os.Stat(s.opts.CustomCSS); err == nil {
+		version = info.ModTime().UnixNano()
+	}
+	href := "/custom.css?v=" + strconv.FormatInt(version, 36)
+	return fmt.Sprintf(`<link rel="stylesheet" id="livemd-custom-css" href="%s">`, html.EscapeString(href)) + "\n"
+}
+
+// handleCustomCSS serves GET /custom.css, the --css file. Pages link to it
+// with a cache-buster, so it may be cached for as long as browsers like.
+func (s *Server) handleCustomCSS(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if r.URL.Query().Get("v") != "" {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	}
+	w.Header().Set("Content-Type", "text/css; charset=utf-8")
+	http.ServeFile(w, r, s.opts.CustomCSS)
+}
+
+// watchCustomCSS tells every browser to fetch the --css stylesheet again
+// when path changes, without re-rendering the document.
+func (h *Hub) watchCustomCSS(path string) error {
+	w := NewWatcher(h.debounce)
+	w.WatchParent = true // editors that save by replacing the file
+	return w.Watch(path, func() {
+		h.logger.Info("Stylesheet changed", "file", filepath.Base(path))
+		data, _ := json.Marshal(Message{Type: "reload", Reload: "css"})
+		h.publish(data)
+	}, func() {
+		h.logger.Warn("Stylesheet deleted", "file", filepath.Base(path))
+	})
+}
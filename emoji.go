@@ -0,0 +1,52 @@
+package main
+
+import (
+	"github.com/kyokomi/emoji/v2"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// emojiExtension turns GitHub emoji shortcodes such as :smile: into the
+// Unicode character, looked up in kyokomi/emoji's table. Unknown shortcodes
+// stay as written. NewRenderer adds it unless WithoutEmoji is given.
+type emojiExtension struct{}
+
+func (e *emojiExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithInlineParsers(
+		// After everything else starting with ':' would have had its turn.
+		util.Prioritized(&emojiParser{}, 999),
+	))
+}
+
+// emojiParser parses one :shortcode: into a string node holding its emoji.
+type emojiParser struct{}
+
+func (p *emojiParser) Trigger() []byte {
+	return []byte{':'}
+}
+
+func (p *emojiParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	line, _ := block.PeekLine()
+	end := 1
+	for end < len(line) && isShortcodeChar(line[end]) {
+		end++
+	}
+	if end == 1 || end >= len(line) || line[end] != ':' {
+		return nil
+	}
+	value, ok := emoji.CodeMap()[string(line[:end+1])]
+	if !ok {
+		return nil
+	}
+	block.Advance(end + 1)
+	return ast.NewString([]byte(value))
+}
+
+// isShortcodeChar reports whether c may appear between the colons of an
+// emoji shortcode, as in :+1:, :e-mail: or :woman_technologist:.
+func isShortcodeChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '_' || c == '+' || c == '-'
+}
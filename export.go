@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"html/template"
+	"mime"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// singlePageBody is the content written by --export-single-page: a table of
+// contents and every section. The page around it comes from an export
+// template, static/export.html unless --export-template says otherwise.
+var singlePageBody = template.Must(template.New("single-page").Parse(`        <nav class="toc">
+            <ol>
+{{range .Sections}}                <li><a href="#{{.ID}}">{{.Title}}</a></li>
+{{end}}            </ol>
+        </nav>
+{{range $i, $s := .Sections}}{{if $i}}        <hr>
+{{end}}        <section id="{{$s.ID}}">
+{{$s.HTML}}
+        </section>
+{{end}}`))
+
+// ExportData is what an export template is executed with.
+type ExportData struct {
+	Title     string        // name of the exported folder
+	Body      template.HTML // table of contents and sections, already rendered
+	CSS       template.CSS  // livemd's stylesheet, for inlining in <style>
+	Date      string        // day of the export, 2006-01-02
+	WordCount int           // words in the markdown of every section
+}
+
+// loadExportTemplate parses the --export-template file, or the default
+// static/export.html if path is empty.
+func loadExportTemplate(path string) (*template.Template, error) {
+	if path == "" {
+		return template.ParseFS(staticFiles, "static/export.html")
+	}
+	return template.ParseFiles(path)
+}
+
+// exportSection is one markdown file of a single-page export.
+type exportSection struct {
+	Path  string
+	ID    string
+	Title string
+	HTML  template.HTML
+	order int // front matter "order:"; files without one sort after
+}
+
+// frontMatterOrder matches the "order: N" (or "weight: N") line of a
+// leading YAML front matter block.
+var frontMatterOrder = regexp.MustCompile(`(?m)^(?:order|weight):\s*(-?\d+)\s*$`)
+
+// splitFrontMatter separates a leading "---" YAML front matter block from
+// the markdown body. It returns nil front matter if there is none.
+func splitFrontMatter(content []byte) (front, body []byte) {
+	content = bytes.TrimPrefix(content, []byte("\xef\xbb\xbf"))
+	if !bytes.HasPrefix(content, []byte("---\n")) && !bytes.HasPrefix(content, []byte("---\r\n")) {
+		return nil, content
+	}
+	rest := content[bytes.IndexByte(content, '\n')+1:]
+	for off := 0; off < len(rest); {
+		end := bytes.IndexByte(rest[off:], '\n')
+		line := rest[off:]
+		if end >= 0 {
+			line = rest[off : off+end]
+		}
+		if string(bytes.TrimRight(line, "\r")) == "---" {
+			if end < 0 {
+				return rest[:off], nil
+			}
+			return rest[:off], rest[off+end+1:]
+		}
+		if end < 0 {
+			break
+		}
+		off += end + 1
+	}
+	return nil, content // unterminated: not front matter
+}
+
+// frontMatterWeight returns the "order:"/"weight:" value of front matter.
+func frontMatterWeight(front []byte) (int, bool) {
+	m := frontMatterOrder.FindSubmatch(front)
+	if m == nil {
+		return 0, false
+	}
+	n, err := strconv.Atoi(string(m[1]))
+	return n, err == nil
+}
+
+// exportSinglePage renders every markdown file under dir into one HTML
+// document at out (--export-single-page), laid out by the export template at
+// templatePath (default static/export.html). Files are ordered by their front
+// matter "order:" value, then by path; links between them become in-page
+// anchors and local images are embedded as data: URIs.
+func exportSinglePage(dir, out string, depth int, templatePath string) error {
+	page, err := loadExportTemplate(templatePath)
+	if err != nil {
+		return fmt.Errorf("export template: %w", err)
+	}
+	paths, err := walkFolder(&WatchedFolder{Path: dir, Recursive: true, Depth: depth})
+	if err != nil {
+		return err
+	}
+
+	r := NewRenderer()
+	var sections []*exportSection
+	words := 0
+	ids := make(map[string]bool)
+	for _, p := range paths {
+		if !isMarkdown(p) {
+			continue
+		}
+		content, err := r.readText(p)
+		if err != nil {
+			return err
+		}
+		front, body := splitFrontMatter(content)
+		words += len(strings.Fields(string(body)))
+		s := &exportSection{Path: p, order: int(^uint(0) >> 1)}
+		if order, ok := frontMatterWeight(front); ok {
+			s.order = order
+		}
+		rendered, err := r.renderMarkdown(body)
+		if err != nil {
+			return fmt.Errorf("rendering %s: %w", filepath.Base(p), err)
+		}
+
+		rel, _ := filepath.Rel(dir, p)
+		s.Title = firstH1Text(rendered)
+		if s.Title == "" {
+			s.Title = filepath.ToSlash(rel)
+		}
+		// The extension keeps section ids apart from heading ids, which
+		// AutoHeadingID never gives a dot.
+		base := filepath.Base(p)
+		s.ID = base
+		for i := 2; ids[s.ID]; i++ {
+			s.ID = fmt.Sprintf("%s-%d", base, i)
+		}
+		ids[s.ID] = true
+		s.HTML = template.HTML(prefixFootnoteIDs(rendered, s.ID+"-"))
+		sections = append(sections, s)
+	}
+	if len(sections) == 0 {
+		return fmt.Errorf("no markdown files found in %s", dir)
+	}
+
+	sort.SliceStable(sections, func(i, j int) bool {
+		if sections[i].order != sections[j].order {
+			return sections[i].order < sections[j].order
+		}
+		return sections[i].Path < sections[j].Path
+	})
+
+	anchors := make(map[string]string, len(sections))
+	for _, s := range sections {
+		anchors[s.Path] = s.ID
+	}
+	for _, s := range sections {
+		s.HTML = template.HTML(resolveExportLinks(string(s.HTML), filepath.Dir(s.Path), anchors))
+	}
+
+	var body bytes.Buffer
+	if err := singlePageBody.Execute(&body, map[string]interface{}{"Sections": sections}); err != nil {
+		return err
+	}
+	css, _ := staticFiles.ReadFile("static/style.css")
+	var buf bytes.Buffer
+	err = page.Execute(&buf, ExportData{
+		Title:     filepath.Base(dir),
+		Body:      template.HTML(body.String()),
+		CSS:       template.CSS(css),
+		Date:      time.Now().Format("2006-01-02"),
+		WordCount: words,
+	})
+	if err != nil {
+		return fmt.Errorf("export template: %w", err)
+	}
+	return os.WriteFile(out, buf.Bytes(), 0644)
+}
+
+// footnoteIDPattern matches the id and in-page href values goldmark gives
+// footnotes and their references: fn:1, fnref:1, fnref2:1.
+var footnoteIDPattern = regexp.MustCompile(`(id="|href="#)(fn(?:ref\d*)?:)`)
+
+// prefixFootnoteIDs keeps the footnotes of one section of a single-page
+// export apart from another section's, which are numbered from 1 too.
+func prefixFootnoteIDs(rendered, prefix string) string {
+	prefix = strings.ReplaceAll(html.EscapeString(prefix), "$", "$$")
+	return footnoteIDPattern.ReplaceAllString(rendered, "${1}"+prefix+"${2}")
+}
+
+// resolveExportLinks rewrites the relative href/src values of one section:
+// links to another exported file point at its section, and images are
+// inlined. Anything else is left alone.
+func resolveExportLinks(rendered, dir string, anchors map[string]string) string {
+	return linkAttrPattern.ReplaceAllStringFunc(rendered, func(m string) string {
+		sub := linkAttrPattern.FindStringSubmatch(m)
+		value := html.UnescapeString(sub[2])
+		u, err := url.Parse(value)
+		if err != nil || u.Scheme != "" || u.Host != "" || u.Path == "" || strings.HasPrefix(u.Path, "/") {
+			return m
+		}
+		target := filepath.Join(dir, filepath.FromSlash(u.Path))
+		if strings.HasSuffix(sub[1], "src=\"") {
+			if data, ok := dataURI(target); ok {
+				return sub[1] + data + sub[3]
+			}
+			return m
+		}
+		if id, ok := anchors[target]; ok {
+			if u.Fragment != "" {
+				id = u.Fragment
+			}
+			return sub[1] + "#" + html.EscapeString(id) + sub[3]
+		}
+		return m
+	})
+}
+
+// dataURI returns the file at path as a base64 data: URI.
+func dataURI(path string) (string, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", false
+	}
+	contentType := mime.TypeByExtension(strings.ToLower(filepath.Ext(path)))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return "data:" + contentType + ";base64," + base64.StdEncoding.EncodeToString(data), true
+}
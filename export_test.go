@@ -0,0 +1,77 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// footnoteDoc has headings named after the ids goldmark gives its footnotes.
+const footnoteDoc = "# fn:1\n\n## fnref:1\n\nA claim.[^1]\n\n### fn1\n\n[^1]: The source.\n"
+
+var idAttr = regexp.MustCompile(`\sid="([^"]*)"`)
+
+// checkUniqueIDs fails t if an id is used twice in html, or an in-page href
+// points at no id.
+func checkUniqueIDs(t *testing.T, name, html string) {
+	t.Helper()
+	ids := make(map[string]bool)
+	for _, m := range idAttr.FindAllStringSubmatch(html, -1) {
+		if ids[m[1]] {
+			t.Errorf("%s: id %q is used twice in %s", name, m[1], html)
+		}
+		ids[m[1]] = true
+	}
+	for _, m := range regexp.MustCompile(`href="#([^"]*)"`).FindAllStringSubmatch(html, -1) {
+		if !ids[m[1]] {
+			t.Errorf("%s: href #%s points at no id", name, m[1])
+		}
+	}
+}
+
+func TestFootnoteAndHeadingIDsDontCollide(t *testing.T) {
+	html, err := NewRenderer().renderMarkdown([]byte(footnoteDoc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(html, `id="fn:1"`) || !strings.Contains(html, `id="fnref:1"`) {
+		t.Fatalf("no footnote ids in %s", html)
+	}
+	checkUniqueIDs(t, "render", html)
+
+	prefixed := prefixFootnoteIDs(html, "doc.md-")
+	if !strings.Contains(prefixed, `id="doc.md-fn:1"`) || !strings.Contains(prefixed, `href="#doc.md-fn:1"`) {
+		t.Errorf("footnote ids not prefixed: %s", prefixed)
+	}
+	checkUniqueIDs(t, "prefixFootnoteIDs", prefixed)
+}
+
+func TestExportKeepsFootnoteIDsApart(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "a.md"), footnoteDoc)
+	writeFile(t, filepath.Join(dir, "b.md"), footnoteDoc)
+	out := filepath.Join(t.TempDir(), "out.html")
+	if err := exportSinglePage(dir, out, 0, ""); err != nil {
+		t.Fatal(err)
+	}
+	page, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Headings repeat across files like any export; footnotes mustn't.
+	for _, id := range []string{"a.md-fn:1", "a.md-fnref:1", "b.md-fn:1", "b.md-fnref:1"} {
+		if n := strings.Count(string(page), `id="`+id+`"`); n != 1 {
+			t.Errorf("id %q appears %d times, want once", id, n)
+		}
+	}
+	for _, href := range []string{"a.md-fn:1", "a.md-fnref:1", "b.md-fn:1", "b.md-fnref:1"} {
+		if !strings.Contains(string(page), `href="#`+href+`"`) {
+			t.Errorf("no link to %q", href)
+		}
+	}
+	if strings.Contains(string(page), `id="fn:1"`) {
+		t.Error("an unprefixed footnote id is left in the export")
+	}
+}
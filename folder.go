@@ -7,8 +7,10 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/fsnotify/fsnotify"
 )
@@ -21,6 +23,7 @@ type WatchedFolder struct {
 	Recursive  bool     `json:"recursive"`
 	Depth      int      `json:"depth,omitempty"` // 0 = unlimited (non-git mode only)
 	Live       bool     `json:"live"`
+	Unsaved    bool     `json:"-"` // left out of the state file, with its files (--serve-multiple)
 }
 
 // allowedExt returns true if path matches the folder's extension filter.
@@ -138,6 +141,10 @@ func walkFolder(folder *WatchedFolder) ([]string, error) {
 	return files, err
 }
 
+// createSettleDelay is how long --watch-create-only waits after a Create
+// event before rendering the new file.
+const createSettleDelay = 200 * time.Millisecond
+
 // FolderManager owns a single fsnotify watcher across every followed folder
 // directory and dispatches Create events to the Hub for auto-registration.
 type FolderManager struct {
@@ -146,6 +153,7 @@ type FolderManager struct {
 	mu       sync.Mutex
 	folders  map[string]*WatchedFolder // root path -> folder
 	dirToRoot map[string]string         // any subdir path -> folder.Path it belongs to
+	paused   bool                      // --watch-on-demand with no browsers connected
 	done     chan struct{}
 }
 
@@ -165,6 +173,14 @@ func NewFolderManager(hub *Hub) (*FolderManager, error) {
 	return fm, nil
 }
 
+// WatchedPaths returns the directories subscribed to across every followed
+// folder, sorted.
+func (fm *FolderManager) WatchedPaths() []string {
+	paths := fm.watcher.WatchList()
+	sort.Strings(paths)
+	return paths
+}
+
 // Follow registers a folder, runs initial discovery, and starts watching it
 // (recursively if folder.Recursive). Returns the list of newly discovered files.
 func (fm *FolderManager) Follow(folder *WatchedFolder) ([]string, error) {
@@ -178,9 +194,16 @@ func (fm *FolderManager) Follow(folder *WatchedFolder) ([]string, error) {
 		return nil, err
 	}
 
+	fm.mu.Lock()
+	paused := fm.paused
+	fm.mu.Unlock()
+	if paused {
+		return files, nil // Resume subscribes it
+	}
+
 	// Subscribe directories so future Create events fire.
 	if err := fm.subscribeTree(folder.Path, folder); err != nil {
-		fm.hub.logger.Warn(fmt.Sprintf("Folder watcher subscribe partial failure for %s: %v", folder.Path, err))
+		fm.hub.logger.Warn("Folder watcher subscribe partial failure", "folder", folder.Path, "err", err)
 	}
 	return files, nil
 }
@@ -207,6 +230,43 @@ func (fm *FolderManager) SetLive(rootPath string, live bool) {
 	}
 }
 
+// Pause unsubscribes every folder directory (--watch-on-demand). Folders stay
+// followed; Resume subscribes them again.
+func (fm *FolderManager) Pause() {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+	fm.paused = true
+	for dir := range fm.dirToRoot {
+		fm.watcher.Remove(dir)
+		delete(fm.dirToRoot, dir)
+	}
+}
+
+// Resume re-subscribes the followed folders and auto-adds files created while
+// paused.
+func (fm *FolderManager) Resume() {
+	fm.mu.Lock()
+	fm.paused = false
+	folders := make([]*WatchedFolder, 0, len(fm.folders))
+	for _, f := range fm.folders {
+		folders = append(folders, f)
+	}
+	fm.mu.Unlock()
+
+	for _, folder := range folders {
+		if err := fm.subscribeTree(folder.Path, folder); err != nil {
+			fm.hub.logger.Warn("Folder watcher subscribe partial failure", "folder", folder.Path, "err", err)
+		}
+		if !folder.Live {
+			continue
+		}
+		files, _ := walkFolder(folder)
+		for _, f := range files {
+			fm.maybeAddFile(folder, f)
+		}
+	}
+}
+
 func (fm *FolderManager) Close() {
 	close(fm.done)
 	fm.watcher.Close()
@@ -255,13 +315,20 @@ func (fm *FolderManager) run() {
 				return
 			}
 			if ev.Op&fsnotify.Create == fsnotify.Create {
-				fm.handleCreate(ev.Name)
+				if fm.hub.createOnly {
+					// The file is usually written right after it is created;
+					// give the writer a moment so the first render has content.
+					name := ev.Name
+					time.AfterFunc(createSettleDelay, func() { fm.handleCreate(name) })
+				} else {
+					fm.handleCreate(ev.Name)
+				}
 			}
 		case err, ok := <-fm.watcher.Errors:
 			if !ok {
 				return
 			}
-			fm.hub.logger.Warn(fmt.Sprintf("Folder watcher error: %v", err))
+			fm.hub.logger.Warn("Folder watcher error", "err", err)
 		}
 	}
 }
@@ -283,7 +350,7 @@ func (fm *FolderManager) handleCreate(path string) {
 	fm.mu.Unlock()
 
 	if !live {
-		fm.hub.logger.Info(fmt.Sprintf("Live=off, skipping create: %s", filepath.Base(path)))
+		fm.hub.logger.Info("Live=off, skipping create", "file", filepath.Base(path))
 		return
 	}
 
@@ -317,11 +384,14 @@ func (fm *FolderManager) maybeAddFile(folder *WatchedFolder, path string) {
 	if err := fm.hub.AddFile(path); err != nil {
 		// Already-registered errors are expected when a file came in via two paths.
 		if !strings.Contains(err.Error(), "already registered") {
-			fm.hub.logger.Warn(fmt.Sprintf("Auto-add %s: %v", path, err))
+			fm.hub.logger.Warn("Auto-add failed", "path", path, "err", err)
 		}
 		return
 	}
-	fm.hub.logger.Info(fmt.Sprintf("Auto-added: %s", filepath.Base(path)))
+	fm.hub.logger.Info("Auto-added", "file", filepath.Base(path))
 	fm.hub.persistState()
+	if fm.hub.createOnly {
+		fm.hub.broadcastSelect(path)
+	}
 }
 
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// fragmentData is what --global-header/--global-footer (and --inject-head)
+// templates can use.
+type fragmentData struct {
+	Filename  string // base name of the rendered file
+	Title     string // page title: first heading or file name
+	WordCount int    // words in the markdown source
+	Date      string // file's last modification date, YYYY-MM-DD
+}
+
+// htmlFragment is a user-supplied HTML template file placed around rendered
+// markdown. It is re-parsed only when the file's size or mtime changes, so
+// edits show up on the next render without a restart.
+type htmlFragment struct {
+	path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+	tmpl    *template.Template
+}
+
+func newHTMLFragment(path string) *htmlFragment {
+	return &htmlFragment{path: path}
+}
+
+func (f *htmlFragment) render(data fragmentData) (string, error) {
+	var buf bytes.Buffer
+	if err := f.execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// execute writes the template executed with data to w, parsing the file
+// again first if it changed. --template pages use it with pageData.
+func (f *htmlFragment) execute(w io.Writer, data interface{}) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return err
+	}
+	if f.tmpl == nil || !info.ModTime().Equal(f.modTime) || info.Size() != f.size {
+		src, err := os.ReadFile(f.path)
+		if err != nil {
+			return err
+		}
+		tmpl, err := template.New(filepath.Base(f.path)).Parse(string(src))
+		if err != nil {
+			return err
+		}
+		f.tmpl, f.modTime, f.size = tmpl, info.ModTime(), info.Size()
+	}
+	return f.tmpl.Execute(w, data)
+}
@@ -0,0 +1,37 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// filesystemMagic names the statfs(2) f_type values livemd users are likely
+// to hit; see statfs(2) and linux/magic.h.
+var filesystemMagic = map[uint32]string{
+	0x6969:     "nfs",
+	0xFF534D42: "cifs",
+	0xFE534D42: "smb2",
+	0x517B:     "smb",
+	0x65735546: "fuse",
+	0x01021994: "tmpfs",
+	0xEF53:     "ext4",
+	0x58465342: "xfs",
+	0x9123683E: "btrfs",
+	0x794C7630: "overlayfs",
+	0x01021997: "v9fs",
+	0x2FC12FC1: "zfs",
+}
+
+// filesystemType names the filesystem path lives on, for diagnostics.
+func filesystemType(path string) string {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return "unknown"
+	}
+	if name, ok := filesystemMagic[uint32(st.Type)]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%X", uint32(st.Type))
+}
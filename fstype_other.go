@@ -0,0 +1,8 @@
+//go:build !linux
+
+package main
+
+// filesystemType is only implemented on Linux.
+func filesystemType(path string) string {
+	return "unknown"
+}
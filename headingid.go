@@ -0,0 +1,60 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+// sectionIDTransformer replaces the id parser.WithAutoHeadingID gave each
+// heading (--heading-id-prefix): its slug gets a prefix hashed from the
+// heading's place in the outline, the headings it is nested under. Two
+// "Introduction" sections under different chapters get different ids, and
+// renaming a heading elsewhere in the document doesn't change them.
+type sectionIDTransformer struct{}
+
+func (t *sectionIDTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+	var outline []*ast.Heading // the heading open at each level, shallowest first
+	used := make(map[string]bool)
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		heading, ok := n.(*ast.Heading)
+		if !entering || !ok {
+			return ast.WalkContinue, nil
+		}
+		for len(outline) > 0 && outline[len(outline)-1].Level >= heading.Level {
+			outline = outline[:len(outline)-1]
+		}
+		var path strings.Builder
+		for _, parent := range outline {
+			path.WriteString(strconv.Itoa(parent.Level) + " " + string(parent.Text(source)) + "\n")
+		}
+		outline = append(outline, heading)
+
+		sum := sha256.Sum256([]byte(path.String()))
+		base := "h" + hex.EncodeToString(sum[:3]) + "-" + headingSlug(heading, source)
+		unique := base
+		for i := 1; used[unique]; i++ {
+			unique = base + "-" + strconv.Itoa(i)
+		}
+		used[unique] = true
+		heading.SetAttributeString("id", []byte(unique))
+		return ast.WalkSkipChildren, nil
+	})
+}
+
+// headingSlug is the id goldmark would give heading if it were the first
+// with its text: the slug without the "-1", "-2", ... of repeats.
+func headingSlug(heading *ast.Heading, source []byte) string {
+	var line []byte
+	if lines := heading.Lines(); lines.Len() > 0 {
+		last := lines.At(lines.Len() - 1)
+		line = last.Value(source)
+	}
+	return string(parser.NewContext().IDs().Generate(line, ast.KindHeading))
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+)
+
+// defaultIncludeDepth is how deeply <!-- include: --> directives nest unless
+// --include-depth says otherwise.
+const defaultIncludeDepth = 10
+
+// includePattern matches an include directive on a line of its own.
+var includePattern = regexp.MustCompile(`^[ \t]*<!--[ \t]*include:[ \t]*(.+?)[ \t]*-->[ \t]*\r?$`)
+
+// fencePattern matches the opening or closing line of a fenced code block,
+// whose content is left alone so directives can be shown in examples.
+var fencePattern = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})")
+
+// includeExpander replaces include directives in markdown with the content
+// of the files they name, recursively.
+type includeExpander struct {
+	read     func(path string) ([]byte, error)
+	maxDepth int
+	included map[string]bool // every file pulled in, for watching
+
+	trackLines bool         // record origins
+	origins    []lineOrigin // where each line of the output came from
+}
+
+// lineOrigin is the file and 0-based line an expanded line was copied from.
+// path is "" for the warning put in place of a directive that failed.
+type lineOrigin struct {
+	path string
+	line int
+}
+
+// expandIncludes replaces each "<!-- include: path.md -->" line of content,
+// the body of the markdown file at path, with the body of the named file,
+// resolved against path's directory and expanded the same way. It also
+// returns the included files, sorted. A directive that can't be followed (a
+// missing file, a cycle, nesting deeper than maxDepth) becomes a quoted
+// warning instead of failing the render.
+func expandIncludes(path string, content []byte, maxDepth int, read func(string) ([]byte, error)) ([]byte, []string) {
+	if maxDepth <= 0 || !bytes.Contains(content, []byte("include:")) {
+		return content, nil
+	}
+	e := &includeExpander{read: read, maxDepth: maxDepth, included: make(map[string]bool)}
+	abs, _ := filepath.Abs(path)
+	expanded := e.expand(abs, content, 0, []string{abs})
+	return expanded, sortedKeys(e.included)
+}
+
+// expand works through content, which starts at line first of the file at
+// path, line by line; stack holds the chain of files that led to it,
+// outermost first.
+func (e *includeExpander) expand(path string, content []byte, first int, stack []string) []byte {
+	var out bytes.Buffer
+	var fence []byte // marker of the open code fence, if any
+	for n := first; len(content) > 0; n++ {
+		line := content
+		if i := bytes.IndexByte(content, '\n'); i >= 0 {
+			line = content[:i+1]
+		}
+		content = content[len(line):]
+
+		if m := fencePattern.FindSubmatch(line); m != nil {
+			if fence == nil {
+				fence = m[1]
+			} else if m[1][0] == fence[0] && len(m[1]) >= len(fence) {
+				fence = nil
+			}
+		}
+		m := includePattern.FindSubmatch(bytes.TrimRight(line, "\n"))
+		if fence != nil || m == nil {
+			out.Write(line)
+			e.track(path, n)
+			continue
+		}
+
+		name := string(m[1])
+		target := filepath.Join(filepath.Dir(path), filepath.FromSlash(name))
+		body, err := e.include(target, stack)
+		if err != nil {
+			fmt.Fprintf(&out, "> **livemd:** can't include %s: %v\n", name, err)
+			e.track("", -1)
+			continue
+		}
+		out.Write(body)
+		if len(body) > 0 && body[len(body)-1] != '\n' {
+			out.WriteByte('\n')
+		}
+	}
+	return out.Bytes()
+}
+
+// include reads and expands target, the file named by a directive.
+func (e *includeExpander) include(target string, stack []string) ([]byte, error) {
+	for _, p := range stack {
+		if PathsEqual(p, target) {
+			return nil, fmt.Errorf("include cycle")
+		}
+	}
+	if len(stack) > e.maxDepth {
+		return nil, fmt.Errorf("includes nested deeper than %d", e.maxDepth)
+	}
+	e.included[target] = true
+	content, err := e.read(target)
+	if err != nil {
+		return nil, err
+	}
+	front, body := splitFrontMatter(content)
+	return e.expand(target, body, frontMatterLines(front), append(stack[:len(stack):len(stack)], target)), nil
+}
+
+// track records the origin of the line just written, with trackLines.
+func (e *includeExpander) track(path string, line int) {
+	if e.trackLines {
+		e.origins = append(e.origins, lineOrigin{path, line})
+	}
+}
+
+// frontMatterLines is how many lines front matter split off by
+// splitFrontMatter took up, with its two "---" lines; 0 for none.
+func frontMatterLines(front []byte) int {
+	if front == nil {
+		return 0
+	}
+	return bytes.Count(front, []byte("\n")) + 2
+}
+
+// includingWatcher is the FileWatcher of a markdown file, plus one for each
+// file it includes, so a change to any of them re-renders the document.
+// Closing it closes them all.
+type includingWatcher struct {
+	FileWatcher
+	newWatcher func(path string) FileWatcher
+
+	mu       sync.Mutex
+	includes map[string]FileWatcher
+	closed   bool
+}
+
+func newIncludingWatcher(w FileWatcher, newWatcher func(path string) FileWatcher) *includingWatcher {
+	return &includingWatcher{
+		FileWatcher: w,
+		newWatcher:  newWatcher,
+		includes:    make(map[string]FileWatcher),
+	}
+}
+
+// SetIncludes watches paths, the files the document includes as of its
+// latest render, calling onChange when one changes, and stops watching the
+// ones it no longer includes. A missing file isn't watched; the document
+// picks it up once it changes itself.
+func (w *includingWatcher) SetIncludes(paths []string, onChange func()) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return
+	}
+	wanted := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		wanted[path] = true
+		if _, ok := w.includes[path]; ok {
+			continue
+		}
+		path, watcher := path, w.newWatcher(path)
+		onDelete := func() {
+			// A watcher stops at deletion; SetIncludes starts a new one if
+			// the file is back by the next render.
+			w.mu.Lock()
+			if w.includes[path] == watcher {
+				delete(w.includes, path)
+				watcher.Close()
+			}
+			w.mu.Unlock()
+			onChange()
+		}
+		if err := watcher.Watch(path, onChange, onDelete); err != nil {
+			watcher.Close()
+			continue
+		}
+		w.includes[path] = watcher
+	}
+	for path, watcher := range w.includes {
+		if !wanted[path] {
+			watcher.Close()
+			delete(w.includes, path)
+		}
+	}
+}
+
+// WatchedPaths adds the included files to what the document's own watcher
+// is subscribed to.
+func (w *includingWatcher) WatchedPaths() []string {
+	paths := w.FileWatcher.WatchedPaths()
+	w.mu.Lock()
+	for _, watcher := range w.includes {
+		paths = append(paths, watcher.WatchedPaths()...)
+	}
+	w.mu.Unlock()
+	sort.Strings(paths)
+	return paths
+}
+
+func (w *includingWatcher) Close() error {
+	w.mu.Lock()
+	w.closed = true
+	for path, watcher := range w.includes {
+		watcher.Close()
+		delete(w.includes, path)
+	}
+	w.mu.Unlock()
+	return w.FileWatcher.Close()
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// readFrom reads files from a map of absolute paths, for expandIncludes.
+func readFrom(files map[string]string) func(string) ([]byte, error) {
+	return func(path string) ([]byte, error) {
+		content, ok := files[path]
+		if !ok {
+			return nil, os.ErrNotExist
+		}
+		return []byte(content), nil
+	}
+}
+
+func TestExpandIncludes(t *testing.T) {
+	dir := t.TempDir()
+	main := filepath.Join(dir, "main.md")
+	sub := filepath.Join(dir, "sub", "part.md")
+	tests := []struct {
+		name     string
+		content  string
+		files    map[string]string
+		depth    int
+		want     string
+		included []string
+	}{
+		{
+			name:     "front matter left out",
+			content:  "a\n<!-- include: b.md -->\nc\n",
+			files:    map[string]string{filepath.Join(dir, "b.md"): "---\ntitle: B\n---\nb\n"},
+			depth:    10,
+			want:     "a\nb\nc\n",
+			included: []string{filepath.Join(dir, "b.md")},
+		},
+		{
+			name:    "relative to the including file",
+			content: "<!-- include: sub/part.md -->\n",
+			files: map[string]string{
+				sub:                               "<!-- include: ../c.md -->\n<!-- include: d.md -->\n",
+				filepath.Join(dir, "c.md"):        "c\n",
+				filepath.Join(dir, "sub", "d.md"): "d",
+			},
+			depth:    10,
+			want:     "c\nd\n",
+			included: []string{filepath.Join(dir, "c.md"), filepath.Join(dir, "sub", "d.md"), sub}, // sorted
+		},
+		{
+			name:    "cycle",
+			content: "<!-- include: b.md -->\n",
+			files: map[string]string{
+				filepath.Join(dir, "b.md"): "b\n<!-- include: main.md -->\n",
+			},
+			depth:    10,
+			want:     "b\n> **livemd:** can't include main.md: include cycle\n",
+			included: []string{filepath.Join(dir, "b.md")},
+		},
+		{
+			name:    "depth limit",
+			content: "<!-- include: b.md -->\n",
+			files: map[string]string{
+				filepath.Join(dir, "b.md"): "b\n<!-- include: c.md -->\n",
+				filepath.Join(dir, "c.md"): "c\n",
+			},
+			depth:    1,
+			want:     "b\n> **livemd:** can't include c.md: includes nested deeper than 1\n",
+			included: []string{filepath.Join(dir, "b.md")},
+		},
+		{
+			name:     "missing file",
+			content:  "<!-- include: gone.md -->\n",
+			depth:    10,
+			want:     "> **livemd:** can't include gone.md: file does not exist\n",
+			included: []string{filepath.Join(dir, "gone.md")},
+		},
+		{
+			name:    "directives in code fences",
+			content: "```md\n<!-- include: b.md -->\n```\n~~~~\n```\n<!-- include: b.md -->\n~~~~\n",
+			files:   map[string]string{filepath.Join(dir, "b.md"): "b\n"},
+			depth:   10,
+			want:    "```md\n<!-- include: b.md -->\n```\n~~~~\n```\n<!-- include: b.md -->\n~~~~\n",
+		},
+		{
+			name:    "depth 0 leaves directives alone",
+			content: "<!-- include: b.md -->\n",
+			files:   map[string]string{filepath.Join(dir, "b.md"): "b\n"},
+			depth:   0,
+			want:    "<!-- include: b.md -->\n",
+		},
+		{
+			name:    "not on a line of its own",
+			content: "see <!-- include: b.md --> here\n",
+			files:   map[string]string{filepath.Join(dir, "b.md"): "b\n"},
+			depth:   10,
+			want:    "see <!-- include: b.md --> here\n",
+		},
+	}
+	for _, tt := range tests {
+		got, included := expandIncludes(main, []byte(tt.content), tt.depth, readFrom(tt.files))
+		if string(got) != tt.want {
+			t.Errorf("%s: expanded to %q, want %q", tt.name, got, tt.want)
+		}
+		if len(included)+len(tt.included) > 0 && !reflect.DeepEqual(included, tt.included) {
+			t.Errorf("%s: included %v, want %v", tt.name, included, tt.included)
+		}
+	}
+}
+
+// fakeWatcher is a FileWatcher that is told of changes by the test.
+type fakeWatcher struct {
+	path               string
+	onChange, onDelete func()
+	closed             bool
+}
+
+func (w *fakeWatcher) Watch(path string, onChange, onDelete func()) error {
+	if strings.HasSuffix(path, "missing.md") {
+		return os.ErrNotExist
+	}
+	w.path, w.onChange, w.onDelete = path, onChange, onDelete
+	return nil
+}
+
+func (w *fakeWatcher) WatchedPaths() []string { return []string{w.path} }
+
+func (w *fakeWatcher) Close() error {
+	w.closed = true
+	return nil
+}
+
+func TestIncludingWatcher(t *testing.T) {
+	watchers := make(map[string]*fakeWatcher)
+	doc := &fakeWatcher{}
+	w := newIncludingWatcher(doc, func(path string) FileWatcher {
+		watchers[path] = &fakeWatcher{}
+		return watchers[path]
+	})
+	if err := w.Watch("doc.md", func() {}, func() {}); err != nil {
+		t.Fatal(err)
+	}
+
+	changes := 0
+	onChange := func() { changes++ }
+	w.SetIncludes([]string{"a.md", "b.md", "missing.md"}, onChange)
+	if got, want := w.WatchedPaths(), []string{"a.md", "b.md", "doc.md"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("WatchedPaths() = %v, want %v", got, want)
+	}
+
+	watchers["b.md"].onChange()
+	if changes != 1 {
+		t.Errorf("a change to an included file re-rendered %d times, want 1", changes)
+	}
+
+	// A deleted include stops being watched, and the document re-renders.
+	watchers["a.md"].onDelete()
+	if changes != 2 || !watchers["a.md"].closed {
+		t.Errorf("after deleting a.md: %d re-renders, closed %v", changes, watchers["a.md"].closed)
+	}
+	if got, want := w.WatchedPaths(), []string{"b.md", "doc.md"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("WatchedPaths() after deleting a.md = %v, want %v", got, want)
+	}
+
+	// Includes dropped from the document are no longer watched.
+	w.SetIncludes([]string{"c.md"}, onChange)
+	if !watchers["b.md"].closed || watchers["c.md"].closed {
+		t.Error("SetIncludes didn't swap b.md for c.md")
+	}
+
+	w.Close()
+	if !doc.closed || !watchers["c.md"].closed {
+		t.Error("Close left a watcher open")
+	}
+	w.SetIncludes([]string{"d.md"}, onChange)
+	if _, ok := watchers["d.md"]; ok {
+		t.Error("SetIncludes after Close started a watcher")
+	}
+}
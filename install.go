@@ -1,10 +1,10 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"net"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -117,13 +117,15 @@ func stopRunningDaemon() bool {
 	if err != nil {
 		return false
 	}
-	resp, _ := http.Post(fmt.Sprintf("http://localhost:%d/api/shutdown", port), "", nil)
+	resp, _ := daemonClient.Post(daemonURL(port, "/api/shutdown"), "", nil)
 	if resp != nil {
 		resp.Body.Close()
 	}
-	addr := fmt.Sprintf("localhost:%d", port)
+	addr := daemonAddr(port)
 	for i := 0; i < 60; i++ {
-		c, err := net.DialTimeout("tcp", addr, 100*time.Millisecond)
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		c, err := dialDaemon(ctx, "tcp", addr)
+		cancel()
 		if err != nil {
 			break
 		}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+// linkAttrPattern matches the href/src attributes goldmark emits. The renderer
+// always writes double-quoted attribute values, so a simple pattern suffices.
+var linkAttrPattern = regexp.MustCompile(`(\s(?:href|src)=")([^"]*)(")`)
+
+// linkRewriteRule is one --link-rewrite-rules entry: every href/src value that
+// matches pattern is replaced via regexp.ReplaceAllString.
+type linkRewriteRule struct {
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+// parseLinkRewriteRule splits "<pattern>:<replacement>" and compiles the
+// pattern. The pattern ends at the first ':' not escaped as '\:', except that
+// an anchored pattern may contain bare colons and ends at the first "$:"
+// (e.g. "^wiki:(.+)$:https://wiki.internal/$1").
+func parseLinkRewriteRule(spec string) (linkRewriteRule, error) {
+	split := -1
+	if i := strings.Index(spec, "$:"); i >= 0 {
+		split = i + 1
+	} else {
+		for i := 0; i < len(spec); i++ {
+			if spec[i] == '\\' {
+				i++ // skip the escaped character
+				continue
+			}
+			if spec[i] == ':' {
+				split = i
+				break
+			}
+		}
+	}
+	if split <= 0 {
+		return linkRewriteRule{}, fmt.Errorf("invalid link rewrite rule %q: want <pattern>:<replacement>", spec)
+	}
+
+	re, err := regexp.Compile(spec[:split])
+	if err != nil {
+		return linkRewriteRule{}, fmt.Errorf("invalid link rewrite pattern %q: %w", spec[:split], err)
+	}
+	return linkRewriteRule{pattern: re, replacement: spec[split+1:]}, nil
+}
+
+// rewriteLinks applies rules, in order, to every href and src attribute in the
+// rendered HTML. Values are unescaped before matching and re-escaped after, so
+// patterns see the URL as the author wrote it.
+func rewriteLinks(rendered string, rules []linkRewriteRule) string {
+	if len(rules) == 0 {
+		return rendered
+	}
+	return linkAttrPattern.ReplaceAllStringFunc(rendered, func(attr string) string {
+		m := linkAttrPattern.FindStringSubmatch(attr)
+		value := html.UnescapeString(m[2])
+		rewritten := value
+		for _, rule := range rules {
+			rewritten = rule.pattern.ReplaceAllString(rewritten, rule.replacement)
+		}
+		if rewritten == value {
+			return attr
+		}
+		return m[1] + html.EscapeString(rewritten) + m[3]
+	})
+}
+
+// anchorHrefPattern matches the start of a link goldmark emits, up to its
+// href value.
+var anchorHrefPattern = regexp.MustCompile(`<a href="([^"]*)"`)
+
+// checkLinks finds the links in rendered markdown to files that don't exist
+// (--check-links): relative hrefs, resolved against dir, the directory of
+// the markdown file. It marks them with class="broken-link" and returns
+// them, as written and without repeats. Links to URLs, to /paths on the
+// server and to #fragments of the document aren't checked.
+func checkLinks(rendered, dir string) (string, []string) {
+	var broken []string
+	seen := make(map[string]bool)
+	marked := anchorHrefPattern.ReplaceAllStringFunc(rendered, func(tag string) string {
+		href := html.UnescapeString(anchorHrefPattern.FindStringSubmatch(tag)[1])
+		u, err := url.Parse(href)
+		if err != nil || u.Scheme != "" || u.Host != "" || u.Path == "" || strings.HasPrefix(u.Path, "/") {
+			return tag
+		}
+		if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(u.Path))); err == nil {
+			return tag
+		}
+		if !seen[href] {
+			seen[href] = true
+			broken = append(broken, href)
+		}
+		return `<a class="broken-link"` + tag[len("<a"):]
+	})
+	return marked, broken
+}
+
+// localFileLinks points every relative href and src attribute in rendered
+// markdown at /file/, which serves the file it names from dir, the
+// directory of the markdown file. Browsers would otherwise resolve them
+// against the server root, where the document's images don't live. It also
+// returns the paths linked, which are all /file/ serves.
+func localFileLinks(rendered, dir string) (string, []string) {
+	var linked []string
+	rendered = linkAttrPattern.ReplaceAllStringFunc(rendered, func(attr string) string {
+		m := linkAttrPattern.FindStringSubmatch(attr)
+		u, err := url.Parse(html.UnescapeString(m[2]))
+		if err != nil || u.Scheme != "" || u.Host != "" || u.Path == "" || strings.HasPrefix(u.Path, "/") {
+			return attr // absolute, a bare #fragment or ?query, or not a URL
+		}
+		path := filepath.Join(dir, filepath.FromSlash(u.Path))
+		linked = append(linked, path)
+		u.Path = localFileURL(path)
+		return m[1] + html.EscapeString(u.String()) + m[3]
+	})
+	return rendered, linked
+}
+
+// hiddenPath reports whether a component of the slash-separated relative
+// path starts with ".", as in .env or .git/config.
+func hiddenPath(rel string) bool {
+	for _, part := range strings.Split(rel, "/") {
+		if strings.HasPrefix(part, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+// localFileURL is the /file/ URL path of the absolute path.
+func localFileURL(path string) string {
+	return "/file/" + strings.TrimLeft(filepath.ToSlash(path), "/")
+}
+
+// localFilePath is the absolute path named by what follows /file/ in a URL:
+// the inverse of localFileURL. UNC paths lost their leading slashes there.
+func localFilePath(rel string) string {
+	path := filepath.FromSlash(rel)
+	if filepath.VolumeName(path) != "" {
+		return path
+	}
+	if runtime.GOOS == "windows" {
+		return `\\` + path
+	}
+	return "/" + path
+}
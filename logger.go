@@ -1,6 +1,11 @@
 package main
 
 import (
+	"context"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
@@ -18,6 +23,7 @@ type Logger struct {
 	entries []LogEntry
 	maxSize int
 	hub     *Hub
+	mirror  bool // also write entries to slog (--log-json)
 }
 
 func NewLogger(maxSize int) *Logger {
@@ -31,12 +37,14 @@ func (l *Logger) SetHub(hub *Hub) {
 	l.hub = hub
 }
 
-func (l *Logger) add(level, message string) {
+// add records message with its attributes, args, given as slog's
+// alternating keys and values, e.g. "file", "README.md".
+func (l *Logger) add(level, message string, args []any) {
 	l.mu.Lock()
 	entry := LogEntry{
 		Time:    time.Now(),
 		Level:   level,
-		Message: message,
+		Message: logText(message, args),
 	}
 	l.entries = append(l.entries, entry)
 	if len(l.entries) > l.maxSize {
@@ -44,22 +52,74 @@ func (l *Logger) add(level, message string) {
 	}
 	l.mu.Unlock()
 
+	if l.mirror {
+		slog.Log(context.Background(), slogLevels[level], message, args...)
+	}
+
 	// Broadcast to clients
 	if l.hub != nil {
 		l.hub.broadcastLog(entry)
 	}
 }
 
-func (l *Logger) Info(message string) {
-	l.add("info", message)
+func (l *Logger) Info(message string, args ...any) {
+	l.add("info", message, args)
+}
+
+func (l *Logger) Warn(message string, args ...any) {
+	l.add("warn", message, args)
+}
+
+func (l *Logger) Error(message string, args ...any) {
+	l.add("error", message, args)
+}
+
+// logText is message followed by the attributes in args as key=value pairs,
+// as slog's text handler writes them, for the browser's log panel.
+func logText(message string, args []any) string {
+	if len(args) == 0 {
+		return message
+	}
+	record := slog.NewRecord(time.Time{}, slog.LevelInfo, message, 0)
+	record.Add(args...)
+	var b strings.Builder
+	b.WriteString(message)
+	record.Attrs(func(a slog.Attr) bool {
+		value := a.Value.String()
+		if value == "" || strings.ContainsAny(value, " \"=") {
+			value = strconv.Quote(value)
+		}
+		b.WriteString(" " + a.Key + "=" + value)
+		return true
+	})
+	return b.String()
+}
+
+// slogLevels maps LogEntry levels to slog's.
+var slogLevels = map[string]slog.Level{
+	"info":  slog.LevelInfo,
+	"warn":  slog.LevelWarn,
+	"error": slog.LevelError,
 }
 
-func (l *Logger) Warn(message string) {
-	l.add("warn", message)
+// setupLogging installs the process-wide slog logger: JSON lines on stderr
+// with --log-json, for log aggregators, else the standard log output. Records
+// below level (--log-level) are dropped; any level but info switches the
+// standard output to slog's key=value text, as log can't filter by level.
+func setupLogging(jsonLines bool, level slog.Level) {
+	opts := &slog.HandlerOptions{Level: level}
+	switch {
+	case jsonLines:
+		slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, opts)))
+	case level != slog.LevelInfo:
+		slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, opts)))
+	}
 }
 
-func (l *Logger) Error(message string) {
-	l.add("error", message)
+// fatal logs msg at error level and exits.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
 }
 
 func (l *Logger) GetEntries() []LogEntry {
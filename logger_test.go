@@ -0,0 +1,26 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLogText(t *testing.T) {
+	tests := []struct {
+		message string
+		args    []any
+		want    string
+	}{
+		{"Browser connected", nil, "Browser connected"},
+		{"File changed", []any{"file", "README.md"}, "File changed file=README.md"},
+		{"Error rendering", []any{"file", "my notes.md", "err", errors.New("boom")}, `Error rendering file="my notes.md" err=boom`},
+		{"Browser disconnected", []any{"addr", "127.0.0.1:5000", "connected", 3 * time.Second}, "Browser disconnected addr=127.0.0.1:5000 connected=3s"},
+		{"Empty", []any{"path", ""}, `Empty path=""`},
+	}
+	for _, tt := range tests {
+		if got := logText(tt.message, tt.args); got != tt.want {
+			t.Errorf("logText(%q, %v) = %q, want %q", tt.message, tt.args, got, tt.want)
+		}
+	}
+}
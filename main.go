@@ -29,15 +29,18 @@ package main
 
 import (
 	"bytes"
+	"crypto/tls"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
+	"log/slog"
 	"net"
 	"net/http"
 	"os"
 	"path/filepath"
 	"runtime"
+	"runtime/debug"
 	"strconv"
 	"strings"
 	"time"
@@ -62,6 +65,36 @@ var defaultExtensions = []string{
 // Version is set at build time via -ldflags "-X main.Version=vX.Y.Z"
 var Version = "dev"
 
+// Commit is the git commit livemd was built from, set like Version with
+// -X main.Commit=abc1234. Without it, the one go build stamped is used.
+var Commit = ""
+
+// versionString describes the build as "livemd v1.2.3 (go1.22.0, commit
+// abc1234)", the commit left out when it isn't known.
+func versionString() string {
+	version, commit := Version, Commit
+	goVersion := runtime.Version()
+	if info, ok := debug.ReadBuildInfo(); ok {
+		goVersion = info.GoVersion
+		// Set by "go install ...@v1.2.3" when no -ldflags were given.
+		if version == "dev" && info.Main.Version != "" && info.Main.Version != "(devel)" {
+			version = info.Main.Version
+		}
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" && commit == "" {
+				commit = setting.Value
+			}
+		}
+	}
+	if len(commit) > 7 {
+		commit = commit[:7]
+	}
+	if commit == "" {
+		return fmt.Sprintf("livemd %s (%s)", version, goVersion)
+	}
+	return fmt.Sprintf("livemd %s (%s, commit %s)", version, goVersion, commit)
+}
+
 // main is the entry point for the livemd CLI tool.
 // It parses the first argument as a command and dispatches to the appropriate handler.
 // If no command is provided or an unknown command is given, it displays usage information.
@@ -80,20 +113,151 @@ Usage:
   livemd port <number>                 Set default port
   livemd install                       Self-update from latest GitHub release
   livemd ensure-path                   Add the install dir to PATH
-  livemd version                       Print version
+  livemd version                       Print version, Go version and commit
+                                       (also --version, -v)
 
 Options:
   --port N          Port to serve on (default 3000)
+  --port-auto       Let the OS pick a free port; prints LIVEMD_PORT=N
   --detach          Run as a background daemon
+  --config FILE     Read option defaults from this TOML file
+                    (default ./.livemd.toml if it exists)
+  --open            Open livemd in the default browser once it's listening
+  --server-name S   Server response header value (default "live-md")
+  --hide-server-header
+                    Omit the Server response header
+  --serve-dir       Serve the start directory at /files/ (no listings)
+  --serve-dir-root DIR
+                    Serve DIR at /files/ instead (implies --serve-dir)
+  --ping-endpoint   Answer GET /ping with "pong" (for load balancers)
+  --no-health       Don't serve GET /health (readiness probe)
+  --metrics         Serve Prometheus metrics at GET /metrics
+  --link-rewrite-rules PATTERN:REPLACEMENT
+                    Rewrite href/src in rendered markdown (repeatable)
+  --watch-all       Serve ./static from disk and reload browsers on change
+  --highlight-language-map SRC:DST[,SRC:DST]
+                    Highlight SRC fences as DST (repeatable)
+  --no-unsafe       Omit raw HTML from rendered markdown
+  --unsafe-allow-script
+                    With --no-unsafe, keep <script> and <style> tags
+  --table-class CLASSES
+                    CSS classes for rendered markdown tables
+  --table-wrapper   Wrap tables in a horizontally scrollable div
+  --favicon-file PATH
+                    Serve PATH as the favicon
+  --client-timeout D
+                    Drop WebSocket clients silent for D (default 60s)
+  --bind IP         Listen on this address only (default all interfaces)
+  --socket PATH     Listen on a Unix domain socket instead of a TCP port
+  --auth USER:PASS  Require HTTP Basic auth; CLI commands read LIVEMD_AUTH
+  --ping-interval D Ping WebSocket clients every D (default 30s)
+  --no-ws-compress  Don't compress WebSocket messages
+  --shutdown-grace D
+                    Give browsers D to hear of a shutdown (default 2s)
+  --connection-limit-per-ip N
+                    Refuse more than N browser connections per IP
+  --ws-path P       Serve the WebSocket endpoint at P (default /ws)
+  --static-path P   Serve frontend assets under P (default /static/)
+  --scroll-margin N Leave N pixels above headings scrolled to
+  --doc-charset CS  Read watched files as CS (e.g. windows-1252) or auto
+  --highlight-inline
+                    Highlight inline code written as lang:code
+  --reload-strategy S
+                    Apply updates by replace (default), patch or reload
+  --incremental     Send updates as diffs of the rendered HTML
+  --serve-pdf       Serve /pdf?path=FILE via headless Chromium
+  --pdf-page-size S PDF page size (default A4)
+  --pdf-margins M   PDF page margins (default 1cm)
+  --prerender-pdf   Print PDFs on every change and cache them
+  --watch-network-drive
+                    Poll files on UNC/mapped network drives (Windows)
+  --poll            Poll files for changes instead of using change events
+  --poll-interval D How often polled files are checked (default 500ms)
+  --watch-create-only
+                    Only react to new files; browsers switch to each one
+  --watch-on-demand Watch only while a browser is connected
+  --retry-watch N   Restart a watcher after N straight errors (default 5)
+  --watch-timeout D Poll a file whose watch takes over D (default 5s)
+  --watch-parent-dir
+                    Also watch each file's directory for recreated files
+  --max-concurrent-renders N
+                    Render at most N changed files at once (default 4)
+  --debounce D      Wait D after a file's last write to render (default 100ms)
+  --watch-symlinks  Follow symlinks in watched paths when they are repointed
+  --trim-html       Minify rendered HTML sent to browsers
+  --verbose         Log extra diagnostics
+  --log-json        Write logs to stderr as JSON lines
+  --log-level L     Minimum log level: debug, info (default), warn, error
+  --title-from-h1   Title browser tabs with the document's first heading
+  --global-header FILE
+                    HTML template inserted before rendered markdown
+  --global-footer FILE
+                    HTML template inserted after rendered markdown
+  --inject-head FILE
+                    HTML template inserted into the page <head>
+  --css FILE        Stylesheet added to every page, reloaded when it changes
+  --template FILE   Serve this HTML template at / instead of the sidebar
+                    page; it must use {{.Content}} and {{.WSScript}}
+  --highlight-theme-light NAME
+                    Chroma style for code (default github)
+  --theme NAME      Same as --highlight-theme-light
+  --highlight-theme-dark NAME
+                    Chroma style for code in OS dark mode
+  --highlight-copy-exclude SEL
+                    Leave elements matching SEL out of copied code
+  --math-delimiters S
+                    Math written as $…$ (dollar, default) or \(…\) (latex)
+  --math            Parse math on the server; markdown inside it is kept as is
+  --toc             Table of contents at the top of rendered markdown
+  --toc-depth N     List headings down to level N (default 3)
+  --heading-id-prefix
+                    Prefix heading ids with a hash of their section
+  --no-emoji        Leave :smile: and other emoji shortcodes as text
+  --no-footnotes    Leave [^1] footnotes as text
+  --no-local-files  Don't serve files next to watched markdown at /file/
+  --include-depth N Expand <!-- include: file.md --> N levels deep
+                    (default 10, 0 = off)
+  --plantuml-url URL
+                    Draw plantuml code blocks with the PlantUML server at URL
+  --plantuml-jar PATH
+                    Draw plantuml code blocks by running PATH with java
+  --max-size N      Don't render files over N, e.g. 500KB or 1GB (default 10MB)
+  --check-links     Mark relative links to files that don't exist
+  --word-count-threshold N
+                    Warn when a markdown file passes N words
+  --live-cursor     Show where other viewers of a file are scrolled to
+  --max-cursors N   Show at most N of them (default all)
+  --last-modified-header
+                    Cache validators on /raw and /api/content (304s)
+  --cert FILE       Serve HTTPS with this PEM certificate (needs --key)
+  --key FILE        PEM private key for --cert
+  --tls-self-signed Serve HTTPS with a generated, untrusted certificate
+  --print-ast       Debug: print each markdown AST to stderr
+  --startup-check   Render saved files before serving; exit 1 on failure
+  --serve-multiple  Serve each markdown file here at /file/PATH, index at /
+  --include-nav     Previous/next links on --serve-multiple pages
+  --nav-order-by K  Order those links by weight (default), date or name
+  --cache-dir DIR   Keep rendered markdown in DIR across restarts
+  --cache-max-size N
+                    Cap the cache at N bytes, oldest entries go first
   -r, --recursive   Recursively add files from folder
   --filter EXT      Filter by extensions (comma-separated, e.g. "md,go,js")
+  --export-single-page FILE
+                    Write a folder's markdown as one HTML file (no server)
+  --export-template FILE
+                    Go html/template for that file (see static/export.html)
 
 Examples:
   livemd start --detach
   livemd add README.md
   livemd add ./docs -r
   livemd add ./src -r --filter "md,go"
+  livemd add ./docs --export-single-page docs.html
+  livemd add ./docs --export-single-page docs.html --export-template theme.html
   livemd install
+
+Release builds set the version with
+  go build -ldflags "-X main.Version=v1.2.3 -X main.Commit=abc1234"
 `, Version)
 	}
 
@@ -118,7 +282,7 @@ Examples:
 	case "port":
 		cmdPort()
 	case "version", "--version", "-v":
-		fmt.Printf("livemd %s %s/%s\n", Version, runtime.GOOS, runtime.GOARCH)
+		fmt.Println(versionString())
 	case "install":
 		cmdInstall()
 	case "update":
@@ -143,13 +307,477 @@ func cmdStart() {
 	defaultPort := readConfigPort()
 	fs := flag.NewFlagSet("start", flag.ExitOnError)
 	port := fs.Int("port", defaultPort, "port to serve on")
+	portAuto := fs.Bool("port-auto", false, "listen on a free port chosen by the OS instead of --port, printed as LIVEMD_PORT=N")
 	detach := fs.Bool("detach", false, "run as background daemon")
+	openFlag := fs.Bool("open", false, "open livemd in the default browser once the server is up")
+	serverName := fs.String("server-name", "live-md", "value of the Server response header")
+	hideServerHeader := fs.Bool("hide-server-header", false, "omit the Server response header")
+	serveDir := fs.Bool("serve-dir", false, "serve the start directory at /files/")
+	serveDirRoot := fs.String("serve-dir-root", "", "directory to serve at /files/ (implies --serve-dir)")
+	pingEndpoint := fs.Bool("ping-endpoint", false, "serve a plain-text GET /ping probe")
+	noHealth := fs.Bool("no-health", false, "don't serve the GET /health readiness probe")
+	metrics := fs.Bool("metrics", false, "serve Prometheus metrics at GET /metrics")
+	var linkRules stringList
+	fs.Var(&linkRules, "link-rewrite-rules", "rewrite rendered href/src values, <pattern>:<replacement> (repeatable)")
+	watchAll := fs.Bool("watch-all", false, "serve ./static from disk and reload browsers when it changes")
+	var languageMap stringList
+	fs.Var(&languageMap, "highlight-language-map", "alias fence languages for highlighting, src:dst[,src:dst...] (repeatable)")
+	noUnsafe := fs.Bool("no-unsafe", false, "omit raw HTML from rendered markdown")
+	allowScript := fs.Bool("unsafe-allow-script", false, "with --no-unsafe, still pass <script> and <style> through")
+	tableClass := fs.String("table-class", "", "space-separated CSS classes for rendered markdown tables")
+	tableWrapper := fs.Bool("table-wrapper", false, "wrap rendered markdown tables in a horizontally scrollable div")
+	faviconFile := fs.String("favicon-file", "", "image file to serve as the favicon (ico, png, svg, ...)")
+	scrollMargin := fs.Int("scroll-margin", 0, "pixels to leave above headings scrolled to (e.g. the height of a sticky header)")
+	wsPath := fs.String("ws-path", defaultWSPath, "path of the WebSocket endpoint")
+	staticPath := fs.String("static-path", defaultStaticPath, "path the frontend assets are served under")
+	connLimit := fs.Int("connection-limit-per-ip", 0, "refuse WebSocket connections beyond this many per client IP (0 = unlimited)")
+	clientTimeout := fs.Duration("client-timeout", 60*time.Second, "disconnect WebSocket clients that don't answer pings for this long")
+	bind := fs.String("bind", "", "IP address of the interface to listen on (default all interfaces)")
+	socket := fs.String("socket", "", "listen on this Unix domain socket instead of a TCP port")
+	auth := fs.String("auth", "", "require HTTP Basic auth with these credentials, as user:password")
+	noWSCompress := fs.Bool("no-ws-compress", false, "don't compress WebSocket messages (permessage-deflate)")
+	shutdownGrace := fs.Duration("shutdown-grace", defaultShutdownGrace, "how long to give browsers to receive the shutdown message before closing the listener")
+	pingInterval := fs.Duration("ping-interval", defaultPingInterval, "how often to ping each WebSocket client to notice ones that went away")
+	docCharsetName := fs.String("doc-charset", "", "character encoding of watched files (e.g. windows-1252), or auto")
+	highlightInline := fs.Bool("highlight-inline", false, "syntax-highlight inline code written as lang:code")
+	reloadStrategy := fs.String("reload-strategy", "replace", "how browsers apply updates: replace, patch or reload")
+	incremental := fs.Bool("incremental", false, "send browsers a diff against the previous HTML instead of all of it")
+	servePDF := fs.Bool("serve-pdf", false, "serve GET /pdf?path=FILE, printed with headless Chromium")
+	pdfPageSize := fs.String("pdf-page-size", "A4", "PDF page size (CSS @page size, e.g. A4, Letter, \"210mm 297mm\")")
+	pdfMargins := fs.String("pdf-margins", "1cm", "PDF page margins (CSS margin, e.g. 1cm or \"15mm 10mm\")")
+	prerenderPDF := fs.Bool("prerender-pdf", false, "print the PDF on every change and cache it (implies --serve-pdf)")
+	watchNetworkDrive := fs.Bool("watch-network-drive", false, "poll files on network drives instead of using change events (Windows)")
+	poll := fs.Bool("poll", false, "poll every watched file for changes instead of using change events (NFS, SMB, WSL1)")
+	pollEvery := fs.Duration("poll-interval", pollInterval, "how often polled files are checked")
+	watchCreateOnly := fs.Bool("watch-create-only", false, "only react to new files in followed folders, and show each one as it appears")
+	watchOnDemand := fs.Bool("watch-on-demand", false, "only watch files and folders while at least one browser is connected")
+	watchTimeout := fs.Duration("watch-timeout", 5*time.Second, "poll a file instead if subscribing to its changes takes longer (0 = wait forever)")
+	watchParentDir := fs.Bool("watch-parent-dir", false, "also watch each file's directory, to catch files replaced by a new one (e.g. vim backups)")
+	watchSymlinks := fs.Bool("watch-symlinks", false, "notice when a symlink in a watched file's path is repointed (ln -sfn) and switch to the new target")
+	debounce := fs.Duration("debounce", defaultDebounce, "wait this long after a file's last write before re-rendering it")
+	maxRenders := fs.Int("max-concurrent-renders", 4, "render at most this many changed files at once; others wait up to 5s, then are skipped (0 = unlimited)")
+	retryWatch := fs.Int("retry-watch", 5, "recreate a file's watcher after this many consecutive errors (0 = never)")
+	trimHTMLFlag := fs.Bool("trim-html", false, "minify rendered HTML to shrink WebSocket payloads")
+	verbose := fs.Bool("verbose", false, "log extra diagnostics")
+	logJSON := fs.Bool("log-json", false, "write logs to stderr as JSON lines")
+	logLevel := fs.String("log-level", "info", "drop log records below this level: debug, info, warn or error")
+	titleFromH1 := fs.Bool("title-from-h1", false, "title browser tabs with a document's first heading instead of its file name")
+	globalHeader := fs.String("global-header", "", "HTML template file to insert before every rendered markdown file")
+	globalFooter := fs.String("global-footer", "", "HTML template file to insert after every rendered markdown file")
+	injectHeadFile := fs.String("inject-head", "", "HTML template file to insert into the page <head> (meta tags, analytics, ...)")
+	pageTemplate := fs.String("template", "", "HTML template served at / instead of the sidebar page, showing one document ({{.Content}}, {{.WSScript}}, ...)")
+	customCSS := fs.String("css", "", "CSS file served at /custom.css and linked from every page after the built-in styles")
+	themeLight := fs.String("highlight-theme-light", defaultHighlightTheme, "chroma style for code highlighting (light mode)")
+	theme := fs.String("theme", "", "shorthand for --highlight-theme-light")
+	themeDark := fs.String("highlight-theme-dark", "", "chroma style for code highlighting when the OS is in dark mode")
+	mathDelimiters := fs.String("math-delimiters", "dollar", "math delimiters used in markdown: dollar ($…$, $$…$$) or latex (\\(…\\), \\[…\\])")
+	math := fs.Bool("math", false, "parse $…$ and $$…$$ math when rendering, so markdown inside it is left alone, and typeset only that")
+	toc := fs.Bool("toc", false, "put a table of contents of the headings at the top of rendered markdown")
+	tocDepth := fs.Int("toc-depth", 3, "with --toc, list headings down to this level (1-6)")
+	headingIDPrefix := fs.Bool("heading-id-prefix", false, "prefix heading ids with a short hash of the headings they are nested under")
+	noEmoji := fs.Bool("no-emoji", false, "leave emoji shortcodes like :smile: as text")
+	noFootnotes := fs.Bool("no-footnotes", false, "leave [^1] footnotes as text")
+	maxSize := fs.String("max-size", formatBytes(defaultMaxFileSize), "don't render files larger than this, e.g. 500KB, 10MB or 1GB (0 = no limit)")
+	checkLinks := fs.Bool("check-links", false, "mark relative links to files that don't exist after each render")
+	plantUMLURL := fs.String("plantuml-url", "", "PlantUML server that draws ```plantuml``` code blocks, e.g. http://localhost:8080")
+	plantUMLJar := fs.String("plantuml-jar", "", "plantuml.jar that draws ```plantuml``` code blocks, run with java")
+	includeDepth := fs.Int("include-depth", defaultIncludeDepth, "how deeply <!-- include: file.md --> directives nest (0 = leave them as comments)")
+	noLocalFiles := fs.Bool("no-local-files", false, "don't serve the files next to watched markdown at /file/ or point relative links there")
+	copyExclude := fs.String("highlight-copy-exclude", "", "CSS selector of elements left out when copying from a code block (e.g. \".chroma .gp\" for prompts)")
+	wordCountThreshold := fs.Int("word-count-threshold", 0, "warn in the browser when a markdown file has more words than this (0 = off)")
+	liveCursor := fs.Bool("live-cursor", false, "show each browser where the others viewing the same file are scrolled to")
+	maxCursors := fs.Int("max-cursors", 0, "with --live-cursor, show at most this many other viewers (0 = all)")
+	lastModifiedHeader := fs.Bool("last-modified-header", false, "send a content-hash ETag with /raw and /api/content so unchanged files get 304 Not Modified")
+	certFile := fs.String("cert", "", "PEM certificate file; with --key, serve HTTPS")
+	keyFile := fs.String("key", "", "PEM private key file for --cert")
+	tlsSelfSigned := fs.Bool("tls-self-signed", false, "serve HTTPS with a generated certificate that browsers won't trust")
+	printAST := fs.Bool("print-ast", false, "debug: print the goldmark AST of each rendered markdown file to stderr")
+	serveMultiple := fs.Bool("serve-multiple", false, "serve each markdown file in the start directory at /file/<path>, with an index at /")
+	includeNav := fs.Bool("include-nav", false, "with --serve-multiple, link each page to the previous and next file in its directory")
+	navOrderBy := fs.String("nav-order-by", "weight", "order of --include-nav links: weight, date or name")
+	cacheDir := fs.String("cache-dir", "", "keep rendered markdown in this directory across restarts")
+	cacheMaxSize := fs.Int64("cache-max-size", 0, "with --cache-dir, evict the oldest entries beyond this many bytes (0 = unlimited)")
+	startupCheckFlag := fs.Bool("startup-check", false, "render the saved files once before serving and exit 1 if any fails")
+	fs.String("config", "", "TOML file of option defaults (default ./"+defaultConfigFile+" if it exists)")
+	if err := applyStartDefaults(fs, os.Args[2:]); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
 	fs.Parse(os.Args[2:])
 
+	if *theme != "" {
+		lightSet := false
+		fs.Visit(func(f *flag.Flag) { lightSet = lightSet || f.Name == "highlight-theme-light" })
+		if lightSet && *themeLight != *theme {
+			fmt.Fprintf(os.Stderr, "Error: --theme and --highlight-theme-light disagree; use one\n")
+			os.Exit(1)
+		}
+		*themeLight = *theme
+	}
+
+	opts := &ServerOptions{
+		ServerName:       *serverName,
+		HideServerHeader: *hideServerHeader,
+		ServeDir:         *serveDir || *serveDirRoot != "",
+		PingEndpoint:     *pingEndpoint,
+		NoHealth:         *noHealth,
+		Metrics:          *metrics,
+		NoUnsafe:         *noUnsafe,
+		AllowScript:      *allowScript,
+		TableClass:       strings.Join(strings.Fields(*tableClass), " "),
+		TableWrapper:     *tableWrapper,
+		ClientTimeout:    *clientTimeout,
+		PingInterval:     *pingInterval,
+		NoWSCompress:     *noWSCompress,
+		ShutdownGrace:    *shutdownGrace,
+		Bind:             *bind,
+		Socket:           *socket,
+		HighlightInline:  *highlightInline,
+		ReloadStrategy:   *reloadStrategy,
+		Incremental:      *incremental,
+		ServePDF:         *servePDF || *prerenderPDF,
+		PDFPageSize:      *pdfPageSize,
+		PDFMargins:       *pdfMargins,
+		PrerenderPDF:     *prerenderPDF,
+
+		WatchNetworkDrive: *watchNetworkDrive,
+		Poll:              *poll,
+		PollInterval:      *pollEvery,
+		WatchCreateOnly:   *watchCreateOnly,
+		WatchOnDemand:     *watchOnDemand,
+		RetryWatch:        *retryWatch,
+		WatchTimeout:      *watchTimeout,
+		WatchParentDir:    *watchParentDir,
+		WatchSymlinks:     *watchSymlinks,
+		Debounce:          *debounce,
+
+		MaxConcurrentRenders: *maxRenders,
+
+		TrimHTML: *trimHTMLFlag,
+		Verbose:  *verbose,
+		LogJSON:  *logJSON,
+
+		TitleFromH1: *titleFromH1,
+
+		HighlightThemeLight: *themeLight,
+		HighlightThemeDark:  *themeDark,
+
+		HighlightCopyExclude: *copyExclude,
+
+		PrintAST: *printAST,
+
+		MathDelimiters: *mathDelimiters,
+		Math:           *math,
+
+		TOC:      *toc,
+		TOCDepth: *tocDepth,
+
+		HeadingIDPrefix: *headingIDPrefix,
+
+		NoEmoji:     *noEmoji,
+		NoFootnotes: *noFootnotes,
+
+		NoLocalFiles: *noLocalFiles,
+		IncludeDepth: *includeDepth,
+
+		PlantUMLURL: *plantUMLURL,
+		CheckLinks:  *checkLinks,
+
+		ConnectionLimitPerIP: *connLimit,
+
+		WSPath:     *wsPath,
+		StaticPath: *staticPath,
+
+		ScrollMargin: *scrollMargin,
+
+		OpenBrowser: *openFlag,
+
+		WordCountThreshold: *wordCountThreshold,
+
+		LiveCursor: *liveCursor,
+		MaxCursors: *maxCursors,
+
+		LastModifiedHeader: *lastModifiedHeader,
+
+		TLSSelfSigned: *tlsSelfSigned,
+	}
+	if !strings.HasSuffix(opts.StaticPath, "/") {
+		opts.StaticPath += "/"
+	}
+	if err := checkRoutePaths(opts.WSPath, opts.StaticPath); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	for _, theme := range []string{*themeLight, *themeDark} {
+		if theme != "" && !isHighlightTheme(theme) {
+			fmt.Fprintf(os.Stderr, "Error: unknown highlight theme %q (choose from: %s)\n", theme, strings.Join(highlightThemes(), ", "))
+			os.Exit(1)
+		}
+	}
+	for _, f := range []struct {
+		flag string
+		path string
+		dst  *string
+	}{
+		{"--global-header", *globalHeader, &opts.GlobalHeader},
+		{"--global-footer", *globalFooter, &opts.GlobalFooter},
+		{"--inject-head", *injectHeadFile, &opts.InjectHead},
+		{"--css", *customCSS, &opts.CustomCSS},
+		{"--template", *pageTemplate, &opts.PageTemplate},
+		{"--plantuml-jar", *plantUMLJar, &opts.PlantUMLJar},
+	} {
+		if f.path == "" {
+			continue
+		}
+		abs, _ := filepath.Abs(NormalizePath(f.path))
+		if _, err := os.Stat(abs); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s: %v\n", f.flag, err)
+			os.Exit(1)
+		}
+		*f.dst = abs
+	}
+	maxBytes, err := parseBytes(*maxSize)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: --max-size: %v\n", err)
+		os.Exit(1)
+	}
+	opts.MaxSize = maxBytes
+	if err := checkPlantUML(opts.PlantUMLURL, opts.PlantUMLJar); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if opts.PageTemplate != "" {
+		if *serveMultiple {
+			fmt.Fprintf(os.Stderr, "Error: --template and --serve-multiple can't be used together\n")
+			os.Exit(1)
+		}
+		if err := checkPageTemplate(opts.PageTemplate); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --template: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	// Both end up verbatim in a CSS @page rule.
+	for name, value := range map[string]string{"--pdf-page-size": *pdfPageSize, "--pdf-margins": *pdfMargins} {
+		if !cssLengthListPattern.MatchString(value) {
+			fmt.Fprintf(os.Stderr, "Error: invalid %s %q\n", name, value)
+			os.Exit(1)
+		}
+	}
+	switch *reloadStrategy {
+	case "replace", "patch", "reload":
+	default:
+		fmt.Fprintf(os.Stderr, "Error: --reload-strategy must be replace, patch or reload\n")
+		os.Exit(1)
+	}
+	switch *mathDelimiters {
+	case "dollar", "latex":
+	default:
+		fmt.Fprintf(os.Stderr, "Error: --math-delimiters must be dollar or latex\n")
+		os.Exit(1)
+	}
+	if *tocDepth < 1 || *tocDepth > 6 {
+		fmt.Fprintf(os.Stderr, "Error: --toc-depth must be between 1 and 6\n")
+		os.Exit(1)
+	}
+	if *includeDepth < 0 {
+		fmt.Fprintf(os.Stderr, "Error: --include-depth can't be negative\n")
+		os.Exit(1)
+	}
+	if *wordCountThreshold < 0 {
+		fmt.Fprintf(os.Stderr, "Error: --word-count-threshold can't be negative\n")
+		os.Exit(1)
+	}
+	if *maxCursors < 0 {
+		fmt.Fprintf(os.Stderr, "Error: --max-cursors can't be negative\n")
+		os.Exit(1)
+	}
+	if *maxCursors > 0 && !*liveCursor {
+		fmt.Fprintf(os.Stderr, "Error: --max-cursors needs --live-cursor\n")
+		os.Exit(1)
+	}
+	if *scrollMargin < 0 {
+		fmt.Fprintf(os.Stderr, "Error: --scroll-margin can't be negative\n")
+		os.Exit(1)
+	}
+	if (*certFile == "") != (*keyFile == "") {
+		fmt.Fprintf(os.Stderr, "Error: --cert and --key go together\n")
+		os.Exit(1)
+	}
+	if *certFile != "" {
+		if *tlsSelfSigned {
+			fmt.Fprintf(os.Stderr, "Error: --tls-self-signed can't be combined with --cert\n")
+			os.Exit(1)
+		}
+		// Absolute, since the detached daemon may not share our directory.
+		opts.TLSCert, _ = filepath.Abs(NormalizePath(*certFile))
+		opts.TLSKey, _ = filepath.Abs(NormalizePath(*keyFile))
+		if _, err := tls.LoadX509KeyPair(opts.TLSCert, opts.TLSKey); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --cert/--key: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if *maxRenders < 0 {
+		fmt.Fprintf(os.Stderr, "Error: --max-concurrent-renders can't be negative\n")
+		os.Exit(1)
+	}
+	if *debounce <= 0 {
+		fmt.Fprintf(os.Stderr, "Error: --debounce must be positive\n")
+		os.Exit(1)
+	}
+	if *debounce > 10*time.Second {
+		fmt.Fprintf(os.Stderr, "Warning: --debounce %s delays every update by that much after the last write\n", *debounce)
+	}
+	if *clientTimeout < time.Second {
+		fmt.Fprintf(os.Stderr, "Error: --client-timeout must be at least 1s\n")
+		os.Exit(1)
+	}
+	if *bind != "" && net.ParseIP(*bind) == nil {
+		fmt.Fprintf(os.Stderr, "Error: --bind %q is not an IP address\n", *bind)
+		os.Exit(1)
+	}
+	if *socket != "" {
+		set := make(map[string]bool)
+		fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+		for _, name := range []string{"port", "port-auto", "bind", "open", "serve-pdf", "prerender-pdf"} {
+			if set[name] {
+				fmt.Fprintf(os.Stderr, "Error: --socket and --%s can't be used together\n", name)
+				os.Exit(1)
+			}
+		}
+		abs, err := filepath.Abs(*socket)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error resolving --socket: %v\n", err)
+			os.Exit(1)
+		}
+		*socket = abs
+	}
+	if *auth != "" {
+		user, password, err := parseAuth(*auth)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --auth: %v\n", err)
+			os.Exit(1)
+		}
+		// Headless Chromium, which prints the PDFs, can't log in.
+		set := make(map[string]bool)
+		fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+		for _, name := range []string{"serve-pdf", "prerender-pdf"} {
+			if set[name] {
+				fmt.Fprintf(os.Stderr, "Error: --auth and --%s can't be used together\n", name)
+				os.Exit(1)
+			}
+		}
+		opts.AuthUser, opts.AuthPassword = user, password
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(*logLevel)); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: --log-level must be debug, info, warn or error\n")
+		os.Exit(1)
+	}
+	setupLogging(*logJSON, level)
+	if *pollEvery <= 0 {
+		fmt.Fprintf(os.Stderr, "Error: --poll-interval must be positive\n")
+		os.Exit(1)
+	}
+	if *pingInterval <= 0 {
+		fmt.Fprintf(os.Stderr, "Error: --ping-interval must be positive\n")
+		os.Exit(1)
+	}
+	if *shutdownGrace < 0 {
+		fmt.Fprintf(os.Stderr, "Error: --shutdown-grace can't be negative\n")
+		os.Exit(1)
+	}
+	if *docCharsetName != "" {
+		cs, err := parseDocCharset(*docCharsetName)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --doc-charset: %v\n", err)
+			os.Exit(1)
+		}
+		opts.DocCharset = cs
+	}
+	if *serveMultiple {
+		opts.ServeMultiple, _ = filepath.Abs(".")
+	}
+	if *includeNav && !*serveMultiple {
+		fmt.Fprintf(os.Stderr, "Error: --include-nav needs --serve-multiple\n")
+		os.Exit(1)
+	}
+	switch *navOrderBy {
+	case "weight", "date", "name":
+		opts.IncludeNav = *includeNav
+		opts.NavOrderBy = *navOrderBy
+	default:
+		fmt.Fprintf(os.Stderr, "Error: --nav-order-by must be weight, date or name\n")
+		os.Exit(1)
+	}
+	if *cacheDir != "" {
+		// Absolute, since the detached daemon may not share our directory.
+		abs, _ := filepath.Abs(NormalizePath(*cacheDir))
+		if err := os.MkdirAll(abs, 0755); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --cache-dir: %v\n", err)
+			os.Exit(1)
+		}
+		opts.CacheDir = abs
+		opts.CacheMaxSize = *cacheMaxSize
+	}
+	if *faviconFile != "" {
+		// Resolve now: the detached daemon may not share our working directory.
+		opts.FaviconFile, _ = filepath.Abs(NormalizePath(*faviconFile))
+	}
+	if opts.ServeDir {
+		root := *serveDirRoot
+		if root == "" {
+			root = "."
+		}
+		absRoot, err := filepath.Abs(NormalizePath(root))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error resolving --serve-dir-root: %v\n", err)
+			os.Exit(1)
+		}
+		if info, err := os.Stat(absRoot); err != nil || !info.IsDir() {
+			fmt.Fprintf(os.Stderr, "Error: --serve-dir-root %s is not a directory\n", root)
+			os.Exit(1)
+		}
+		opts.ServeDirRoot = absRoot
+	}
+	for _, spec := range linkRules {
+		rule, err := parseLinkRewriteRule(spec)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		opts.LinkRules = append(opts.LinkRules, rule)
+	}
+	for _, list := range languageMap {
+		for _, pair := range strings.Split(list, ",") {
+			src, dst, ok := strings.Cut(strings.TrimSpace(pair), ":")
+			if !ok || src == "" || dst == "" {
+				fmt.Fprintf(os.Stderr, "Error: invalid --highlight-language-map entry %q: want src:dst\n", pair)
+				os.Exit(1)
+			}
+			if opts.LanguageMap == nil {
+				opts.LanguageMap = make(map[string]string)
+			}
+			opts.LanguageMap[strings.ToLower(src)] = dst
+		}
+	}
+	if *watchAll {
+		// Frontend development mode: expects to run from a livemd checkout.
+		staticDir, _ := filepath.Abs("static")
+		if _, err := os.Stat(filepath.Join(staticDir, "index.html")); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --watch-all needs a static/ directory with index.html in the current directory\n")
+			os.Exit(1)
+		}
+		opts.WatchAll = true
+		opts.StaticDir = staticDir
+	}
+
 	// Check if already running
 	if lockPort, err := readLockFile(); err == nil {
 		fmt.Printf("LiveMD already running on port %d\n", lockPort)
 		printServerAddresses(lockPort)
+		if *openFlag {
+			openBrowser(daemonURL(lockPort, ""))
+		}
 		// --detach is idempotent: already-running is success, not error.
 		if *detach {
 			os.Exit(0)
@@ -157,6 +785,13 @@ func cmdStart() {
 		os.Exit(1)
 	}
 
+	if *startupCheckFlag {
+		if err := startupCheck(opts); err != nil {
+			fmt.Fprintf(os.Stderr, "Startup check failed: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
 	// --detach: re-exec self without the flag, redirected to a log file, then exit.
 	if *detach {
 		var childArgs []string
@@ -166,20 +801,29 @@ func cmdStart() {
 			}
 			childArgs = append(childArgs, a)
 		}
-		daemonize(childArgs)
+		daemonize(childArgs, *portAuto)
 		return
 	}
 
 	// Auto-detect available port if the requested one is in use
 	actualPort := *port
-	if !isPortAvailable(actualPort) {
+	if opts.Socket != "" {
+		actualPort = 0 // the lock file names the socket instead
+	} else if *portAuto {
+		p, err := ephemeralPort(opts.Bind)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --port-auto: %v\n", err)
+			os.Exit(1)
+		}
+		actualPort = p
+	} else if !isPortAvailable(opts.Bind, actualPort) {
 		originalPort := actualPort
-		actualPort = findAvailablePort(actualPort)
+		actualPort = findAvailablePort(opts.Bind, actualPort)
 		fmt.Printf("  Port %d is in use, using port %d instead\n", originalPort, actualPort)
 	}
 
 	// Write lock file
-	if err := writeLockFile(actualPort); err != nil {
+	if err := writeLockFile(actualPort, opts.scheme(), opts.lockHost()); err != nil {
 		fmt.Fprintf(os.Stderr, "Error writing lock file: %v\n", err)
 		os.Exit(1)
 	}
@@ -187,16 +831,69 @@ func cmdStart() {
 	// Start server
 	fmt.Printf("\n  LiveMD server started\n")
 	printServerAddresses(actualPort)
+	if *portAuto {
+		printPortLine(actualPort)
+	}
 	fmt.Println("  Use 'livemd add <file.md>' to watch files")
 	fmt.Println("  Use 'livemd stop' to stop the server")
 	fmt.Println()
 
-	StartServer(actualPort)
+	StartServer(actualPort, opts)
+}
+
+// startupCheck renders every file the daemon would restore from its saved
+// state (--startup-check), with the configured renderer, and reports the time
+// and output size. Files that no longer exist are skipped, as on restore.
+func startupCheck(opts *ServerOptions) error {
+	state, err := loadState()
+	if err != nil {
+		return err
+	}
+	paths := make([]string, 0, len(state.Files))
+	for _, f := range state.Files {
+		paths = append(paths, f.Path)
+	}
+	for i := range state.Folders {
+		files, err := walkFolder(&state.Folders[i])
+		if err != nil {
+			return fmt.Errorf("%s: %w", state.Folders[i].Path, err)
+		}
+		paths = append(paths, files...)
+	}
+
+	renderer := NewRenderer(opts.rendererOptions()...)
+	start := time.Now()
+	rendered, size := 0, 0
+	seen := make(map[string]bool)
+	for _, path := range paths {
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		res, err := renderer.Render(path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		rendered++
+		size += len(res.HTML)
+	}
+	fmt.Printf("  Startup check: rendered %d file(s) in %s (%d bytes)\n",
+		rendered, time.Since(start).Round(time.Millisecond), size)
+	return nil
+}
+
+// printPortLine prints the port the server was given by --port-auto as an
+// unindented LIVEMD_PORT=N line, for scripts to grep.
+func printPortLine(port int) {
+	fmt.Printf("LIVEMD_PORT=%d\n", port)
 }
 
 // isPortAvailable checks if a TCP port can be listened on.
-func isPortAvailable(port int) bool {
-	ln, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+func isPortAvailable(bind string, port int) bool {
+	ln, err := net.Listen("tcp", net.JoinHostPort(bind, strconv.Itoa(port)))
 	if err != nil {
 		return false
 	}
@@ -205,20 +902,30 @@ func isPortAvailable(port int) bool {
 }
 
 // findAvailablePort scans upward from startPort to find the next available port.
-func findAvailablePort(startPort int) int {
+func findAvailablePort(bind string, startPort int) int {
 	for p := startPort + 1; p <= startPort+100; p++ {
-		if isPortAvailable(p) {
+		if isPortAvailable(bind, p) {
 			return p
 		}
 	}
 	// Fallback: let the OS pick
-	ln, err := net.Listen("tcp", ":0")
+	port, err := ephemeralPort(bind)
 	if err != nil {
 		return startPort
 	}
+	return port
+}
+
+// ephemeralPort asks the OS for a free port (--port-auto) by listening on
+// port 0, then closes the listener so the server can bind it.
+func ephemeralPort(bind string) (int, error) {
+	ln, err := net.Listen("tcp", net.JoinHostPort(bind, "0"))
+	if err != nil {
+		return 0, err
+	}
 	port := ln.Addr().(*net.TCPAddr).Port
 	ln.Close()
-	return port
+	return port, nil
 }
 
 // getNetworkAddresses returns all non-loopback IPv4 addresses from active network interfaces.
@@ -268,11 +975,24 @@ func getNetworkAddresses() []string {
 // This provides users with all URLs that can be used to access the server, including
 // localhost for local access and LAN IPs for access from other devices on the network.
 func printServerAddresses(port int) {
-	fmt.Printf("  http://localhost:%d\n", port)
+	scheme := lockScheme()
+	if socket := lockSocket(); socket != "" {
+		fmt.Printf("  %s on unix socket %s\n\n", scheme, socket)
+		return
+	}
+	if host := lockHost(); host != "" {
+		// --bind: that address is the only one that answers.
+		addr := net.JoinHostPort(host, strconv.Itoa(port))
+		fmt.Printf("  %s://%s\n", scheme, addr)
+		fmt.Printf("  Scan QR: %s://%s/qr\n\n", scheme, addr)
+		return
+	}
+	fmt.Printf("  %s://localhost:%d\n", scheme, port)
+	fmt.Printf("  Scan QR: %s://localhost:%d/qr\n", scheme, port)
 
 	networkAddrs := getNetworkAddresses()
 	for _, addr := range networkAddrs {
-		fmt.Printf("  http://%s:%d\n", addr, port)
+		fmt.Printf("  %s://%s:%d\n", scheme, addr, port)
 	}
 	fmt.Println()
 }
@@ -292,6 +1012,8 @@ func cmdAdd() {
 	recursiveLong := fs.Bool("recursive", false, "recursively add files from folder")
 	filter := fs.String("filter", "", "filter by extensions (comma-separated, e.g. \"md,go,js\")")
 	depth := fs.Int("depth", 10, "max recursion depth (non-git fallback only; 0 = unlimited)")
+	exportPage := fs.String("export-single-page", "", "write the folder's markdown files to this HTML file as one document instead of adding it")
+	exportTemplate := fs.String("export-template", "", "Go html/template file laying out the --export-single-page document (see static/export.html)")
 
 	// Reorder args so flags come first (Go flag package stops at first positional arg)
 	args := os.Args[2:]
@@ -302,7 +1024,9 @@ func cmdAdd() {
 		if strings.HasPrefix(arg, "-") {
 			flags = append(flags, arg)
 			// Check if this flag takes a value
-			if (arg == "--filter" || arg == "-filter") && i+1 < len(args) {
+			if (arg == "--filter" || arg == "-filter" ||
+				arg == "--export-single-page" || arg == "-export-single-page" ||
+				arg == "--export-template" || arg == "-export-template") && i+1 < len(args) {
 				i++
 				flags = append(flags, args[i])
 			}
@@ -351,6 +1075,23 @@ func cmdAdd() {
 		os.Exit(1)
 	}
 
+	if *exportTemplate != "" && *exportPage == "" {
+		fmt.Fprintln(os.Stderr, "Error: --export-template only applies to --export-single-page")
+		os.Exit(1)
+	}
+	if *exportPage != "" {
+		if !info.IsDir() {
+			fmt.Fprintf(os.Stderr, "Error: --export-single-page needs a folder, %s is a file\n", pathArg)
+			os.Exit(1)
+		}
+		if err := exportSinglePage(absPath, *exportPage, *depth, *exportTemplate); err != nil {
+			fmt.Fprintf(os.Stderr, "Export failed: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Exported: %s\n", *exportPage)
+		return
+	}
+
 	port, err := readLockFile()
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "LiveMD server not running. Start it with 'livemd start'")
@@ -376,7 +1117,7 @@ func cmdAdd() {
 // to add a single file to the watch list. It reports success or failure to stdout/stderr.
 func addSingleFile(absPath string, port int) {
 	body, _ := json.Marshal(map[string]string{"path": absPath})
-	resp, err := http.Post(fmt.Sprintf("http://localhost:%d/api/watch", port), "application/json", bytes.NewReader(body))
+	resp, err := daemonClient.Post(daemonURL(port, "/api/watch"), "application/json", bytes.NewReader(body))
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error connecting to server: %v\n", err)
 		os.Exit(1)
@@ -417,7 +1158,7 @@ func addFolder(folderPath string, port int, filterExts string, maxDepth int) {
 		"depth":      maxDepth,
 		"live":       true,
 	})
-	resp, err := http.Post(fmt.Sprintf("http://localhost:%d/api/folders", port), "application/json", bytes.NewReader(body))
+	resp, err := daemonClient.Post(daemonURL(port, "/api/folders"), "application/json", bytes.NewReader(body))
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error connecting to server: %v\n", err)
 		os.Exit(1)
@@ -458,8 +1199,8 @@ func cmdRemove() {
 		os.Exit(1)
 	}
 
-	req, _ := http.NewRequest(http.MethodDelete, fmt.Sprintf("http://localhost:%d/api/watch?path=%s", port, absPath), nil)
-	resp, err := http.DefaultClient.Do(req)
+	req, _ := http.NewRequest(http.MethodDelete, daemonURL(port, "/api/watch?path="+absPath), nil)
+	resp, err := daemonClient.Do(req)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error connecting to server: %v\n", err)
 		os.Exit(1)
@@ -485,7 +1226,7 @@ func cmdList() {
 		os.Exit(1)
 	}
 
-	resp, err := http.Get(fmt.Sprintf("http://localhost:%d/api/files", port))
+	resp, err := daemonClient.Get(daemonURL(port, "/api/files"))
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error connecting to server: %v\n", err)
 		os.Exit(1)
@@ -608,10 +1349,18 @@ func getLockFilePath() string {
 	return "/tmp/livemd.lock"
 }
 
-// writeLockFile creates the lock file containing the server's port number.
+// writeLockFile creates the lock file containing the server's port number,
+// followed by "https" if the server uses TLS.
 // Called by cmdStart after verifying no existing server is running.
-func writeLockFile(port int) error {
-	return os.WriteFile(getLockFilePath(), []byte(strconv.Itoa(port)), 0644)
+func writeLockFile(port int, scheme, host string) error {
+	content := strconv.Itoa(port)
+	if scheme == "https" || host != "" {
+		content += " " + scheme
+	}
+	if host != "" {
+		content += " " + host
+	}
+	return os.WriteFile(getLockFilePath(), []byte(content), 0644)
 }
 
 // readLockFile reads the port number from the lock file.
@@ -621,7 +1370,52 @@ func readLockFile() (int, error) {
 	if err != nil {
 		return 0, err
 	}
-	return strconv.Atoi(strings.TrimSpace(string(data)))
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("empty lock file")
+	}
+	return strconv.Atoi(fields[0])
+}
+
+// lockScheme returns "https" if the running server uses TLS, per the lock
+// file, else "http".
+func lockScheme() string {
+	data, err := os.ReadFile(getLockFilePath())
+	if err != nil {
+		return "http"
+	}
+	if fields := strings.Fields(string(data)); len(fields) > 1 && fields[1] == "https" {
+		return "https"
+	}
+	return "http"
+}
+
+// lockHost returns the --bind address of the running server, per the lock
+// file, or "" if it listens on every interface or on a Unix socket.
+func lockHost() string {
+	data, err := os.ReadFile(getLockFilePath())
+	if err != nil {
+		return ""
+	}
+	if fields := strings.SplitN(strings.TrimSpace(string(data)), " ", 3); len(fields) > 2 && !strings.HasPrefix(fields[2], "unix:") {
+		return fields[2]
+	}
+	return ""
+}
+
+// lockSocket returns the Unix socket the running server listens on
+// (--socket), per the lock file, or "".
+func lockSocket() string {
+	data, err := os.ReadFile(getLockFilePath())
+	if err != nil {
+		return ""
+	}
+	if fields := strings.SplitN(strings.TrimSpace(string(data)), " ", 3); len(fields) > 2 {
+		if path, ok := strings.CutPrefix(fields[2], "unix:"); ok {
+			return path
+		}
+	}
+	return ""
 }
 
 // removeLockFile deletes the lock file during server shutdown.
@@ -644,8 +1438,10 @@ func getLogFilePath() string {
 
 // daemonize re-execs the current binary detached from the controlling terminal,
 // redirects stdout/stderr to the daemon log, prints the child's PID, and returns.
-// The caller is the parent and should exit after this returns.
-func daemonize(childArgs []string) {
+// With printPort (--port-auto) it also prints the port the child listens on,
+// as printPortLine does. The caller is the parent and should exit after this
+// returns.
+func daemonize(childArgs []string, printPort bool) {
 	exe, err := os.Executable()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: cannot determine executable path: %v\n", err)
@@ -671,18 +1467,21 @@ func daemonize(childArgs []string) {
 	proc.Release()
 
 	// Wait briefly for the daemon to grab the lock so subsequent CLI calls work.
-	var lockPort int
+	lockPort, locked := 0, false
 	for i := 0; i < 60; i++ {
 		if p, err := readLockFile(); err == nil {
-			lockPort = p
+			lockPort, locked = p, true // 0 with --socket
 			break
 		}
 		time.Sleep(50 * time.Millisecond)
 	}
 
 	fmt.Printf("\n  LiveMD daemon started (PID %d)\n", proc.Pid)
-	if lockPort > 0 {
+	if locked {
 		printServerAddresses(lockPort)
+		if printPort {
+			printPortLine(lockPort)
+		}
 	}
 	fmt.Printf("  Logs: %s\n", logPath)
 	fmt.Println()
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bytes"
+	"regexp"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// Math is typeset in the browser by KaTeX, which finds $…$, $$…$$, \(…\)
+// and \[…\] in the rendered text. Markdown treats \( and \[ as escaped
+// punctuation, though, so the LaTeX-style delimiters lose their backslash
+// before KaTeX sees them. --math-delimiters latex rewrites them to the
+// dollar style in the markdown source, outside code.
+var (
+	latexInlineMath  = regexp.MustCompile(`(?s)\\\((.+?)\\\)`)
+	latexDisplayMath = regexp.MustCompile(`(?s)\\\[(.+?)\\\]`)
+	fenceOpenPattern = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})")
+)
+
+// convertLatexMath rewrites \(…\) to $…$ and \[…\] to $$…$$ everywhere but
+// fenced code blocks and inline code spans.
+func convertLatexMath(src []byte) []byte {
+	var out, text bytes.Buffer
+	flush := func() {
+		out.Write(convertLatexMathText(text.Bytes()))
+		text.Reset()
+	}
+	fence := "" // opening fence while inside a fenced code block
+	for _, line := range bytes.SplitAfter(src, []byte("\n")) {
+		if fence != "" {
+			out.Write(line)
+			if closesFence(line, fence) {
+				fence = ""
+			}
+			continue
+		}
+		if m := fenceOpenPattern.FindSubmatch(line); m != nil {
+			flush()
+			out.Write(line)
+			fence = string(m[1])
+			continue
+		}
+		text.Write(line)
+	}
+	flush()
+	return out.Bytes()
+}
+
+// closesFence reports whether line ends a code block opened by fence: the
+// same character, at least as many times, and nothing else.
+func closesFence(line []byte, fence string) bool {
+	t := bytes.TrimRight(bytes.TrimLeft(line, " "), " \t\r\n")
+	return len(t) >= len(fence) && len(bytes.Trim(t, fence[:1])) == 0
+}
+
+// convertLatexMathText converts the math delimiters of text that holds no
+// fenced code, leaving `code spans` alone.
+func convertLatexMathText(text []byte) []byte {
+	var out []byte
+	convert := func(plain []byte) {
+		plain = latexDisplayMath.ReplaceAll(plain, []byte("$$$$${1}$$$$"))
+		out = append(out, latexInlineMath.ReplaceAll(plain, []byte("$$${1}$$"))...)
+	}
+	for len(text) > 0 {
+		start := bytes.IndexByte(text, '`')
+		if start < 0 {
+			convert(text)
+			break
+		}
+		convert(text[:start])
+		text = text[start:]
+
+		// A code span closes with a backtick run of the same length.
+		n := 0
+		for n < len(text) && text[n] == '`' {
+			n++
+		}
+		end := n
+		for {
+			i := bytes.IndexByte(text[end:], '`')
+			if i < 0 {
+				end = n // unclosed: just the backticks
+				break
+			}
+			end += i
+			run := 0
+			for end+run < len(text) && text[end+run] == '`' {
+				run++
+			}
+			end += run
+			if run == n {
+				break
+			}
+		}
+		out = append(out, text[:end]...)
+		text = text[end:]
+	}
+	return out
+}
+
+// With --math, the markdown parser takes math out of the text itself, so
+// markdown syntax inside it (a_1 * b_1 is emphasis, say) is left alone.
+// $…$ becomes <span class="math-inline">, $$…$$ in running text
+// <span class="math-display"> and a $$ block <div class="math-display">,
+// each holding the raw LaTeX for the browser's KaTeX to typeset.
+type mathInline struct {
+	ast.BaseInline
+	display bool
+}
+
+var kindMathInline = ast.NewNodeKind("MathInline")
+
+func (n *mathInline) Kind() ast.NodeKind { return kindMathInline }
+
+func (n *mathInline) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, nil, nil)
+}
+
+// mathBlock is $$ display math on lines of its own; its Lines are the LaTeX.
+type mathBlock struct {
+	ast.BaseBlock
+	closed bool // the closing $$ has been read
+}
+
+var kindMathBlock = ast.NewNodeKind("MathBlock")
+
+func (n *mathBlock) Kind() ast.NodeKind { return kindMathBlock }
+
+func (n *mathBlock) IsRaw() bool { return true }
+
+func (n *mathBlock) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, nil, nil)
+}
+
+// mathInlineParser reads $…$ and $$…$$ within one line. Like pandoc, it
+// wants no space just inside single dollars and no digit right after the
+// closing one, so prices ("$5 and $10") stay text.
+type mathInlineParser struct{}
+
+func (p *mathInlineParser) Trigger() []byte {
+	return []byte{'$'}
+}
+
+func (p *mathInlineParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	line, segment := block.PeekLine()
+	if bytes.HasPrefix(line, []byte("$$")) {
+		end := bytes.Index(line[2:], []byte("$$"))
+		if end <= 0 {
+			return nil
+		}
+		node := &mathInline{display: true}
+		node.AppendChild(node, ast.NewRawTextSegment(text.NewSegment(segment.Start+2, segment.Start+2+end)))
+		block.Advance(end + 4)
+		return node
+	}
+	if len(line) < 3 || isMathSpace(line[1]) {
+		return nil
+	}
+	for i := 2; i < len(line); i++ {
+		switch {
+		case line[i] == '\\':
+			i++ // escaped character, e.g. \$
+		case line[i] == '$' && !isMathSpace(line[i-1]) && (i+1 == len(line) || line[i+1] < '0' || line[i+1] > '9'):
+			node := &mathInline{}
+			node.AppendChild(node, ast.NewRawTextSegment(text.NewSegment(segment.Start+1, segment.Start+i)))
+			block.Advance(i + 1)
+			return node
+		}
+	}
+	return nil
+}
+
+func isMathSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// mathBlockParser reads a block that opens with $$ and runs to the line
+// ending in $$, which may be the opening line itself.
+type mathBlockParser struct{}
+
+func (p *mathBlockParser) Trigger() []byte {
+	return []byte{'$'}
+}
+
+func (p *mathBlockParser) Open(parent ast.Node, reader text.Reader, pc parser.Context) (ast.Node, parser.State) {
+	line, segment := reader.PeekLine()
+	pos := pc.BlockOffset()
+	if pos < 0 || !bytes.HasPrefix(line[pos:], []byte("$$")) {
+		return nil, parser.NoChildren
+	}
+	node := &mathBlock{}
+	rest := util.TrimRightSpace(line[pos+2:])
+	start := segment.Start + pos + 2
+	if len(rest) >= 2 && bytes.HasSuffix(rest, []byte("$$")) {
+		rest = rest[:len(rest)-2]
+		node.closed = true
+	}
+	if len(util.TrimLeftSpace(rest)) > 0 {
+		node.Lines().Append(text.NewSegment(start, start+len(rest)))
+	}
+	return node, parser.NoChildren
+}
+
+func (p *mathBlockParser) Continue(node ast.Node, reader text.Reader, pc parser.Context) parser.State {
+	n := node.(*mathBlock)
+	if n.closed {
+		return parser.Close
+	}
+	line, segment := reader.PeekLine()
+	trimmed := util.TrimRightSpace(line)
+	if bytes.HasSuffix(trimmed, []byte("$$")) {
+		if len(trimmed) > 2 {
+			n.Lines().Append(text.NewSegment(segment.Start, segment.Start+len(trimmed)-2))
+		}
+		reader.Advance(segment.Len())
+		return parser.Close
+	}
+	n.Lines().Append(segment)
+	reader.Advance(segment.Len() - 1)
+	return parser.Continue | parser.NoChildren
+}
+
+func (p *mathBlockParser) Close(node ast.Node, reader text.Reader, pc parser.Context) {}
+
+func (p *mathBlockParser) CanInterruptParagraph() bool {
+	return true
+}
+
+func (p *mathBlockParser) CanAcceptIndentedLine() bool {
+	return false
+}
+
+// mathRenderer writes math nodes as the KaTeX targets described above.
+type mathRenderer struct{}
+
+func (r *mathRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindMathInline, r.renderInline)
+	reg.Register(kindMathBlock, r.renderBlock)
+}
+
+func (r *mathRenderer) renderInline(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	if node.(*mathInline).display {
+		w.WriteString(`<span class="math-display">`)
+	} else {
+		w.WriteString(`<span class="math-inline">`)
+	}
+	for c := node.FirstChild(); c != nil; c = c.NextSibling() {
+		w.Write(util.EscapeHTML(c.(*ast.Text).Segment.Value(source)))
+	}
+	w.WriteString(`</span>`)
+	return ast.WalkSkipChildren, nil
+}
+
+func (r *mathRenderer) renderBlock(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	w.WriteString(`<div class="math-display">`)
+	for i := 0; i < node.Lines().Len(); i++ {
+		line := node.Lines().At(i)
+		w.Write(util.EscapeHTML(line.Value(source)))
+	}
+	w.WriteString("</div>\n")
+	return ast.WalkSkipChildren, nil
+}
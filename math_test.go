@@ -0,0 +1,67 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMathRendering(t *testing.T) {
+	r := NewRenderer(WithMath())
+	tests := []struct {
+		name, in string
+		want     []string // substrings of the HTML
+		unwanted []string
+	}{
+		{"inline", "Energy: $E=mc^2$.", []string{`<span class="math-inline">E=mc^2</span>`}, nil},
+		{"markdown inside math", "$a_1 * b_1 * c$", []string{`<span class="math-inline">a_1 * b_1 * c</span>`}, []string{"<em>"}},
+		{"prices", "It costs $5 and $10.", []string{"$5 and $10"}, []string{"math-inline"}},
+		{"space inside", "$ x $ stays", []string{"$ x $"}, []string{"math-inline"}},
+		{"escaped dollar", `\$x$ and \$y\$`, []string{"$x$ and $y$"}, []string{"math-inline"}},
+		{"escape inside math", `$a \$ b$`, []string{`<span class="math-inline">a \$ b</span>`}, nil},
+		{"display in text", "see $$x^2$$ here", []string{`<span class="math-display">x^2</span>`}, nil},
+		{"display block", "$$\n\\int_0^1 x\\,dx\n$$\n", []string{`<div class="math-display">\int_0^1 x\,dx`}, nil},
+		{"escaped HTML", "$a<b$", []string{`<span class="math-inline">a&lt;b</span>`}, nil},
+		{"code span", "`$x$`", []string{"<code>$x$</code>"}, []string{"math-inline"}},
+	}
+	for _, tt := range tests {
+		html, err := r.renderMarkdown([]byte(tt.in))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(html, want) {
+				t.Errorf("%s: %q renders as %q, want it to contain %q", tt.name, tt.in, html, want)
+			}
+		}
+		for _, unwanted := range tt.unwanted {
+			if strings.Contains(html, unwanted) {
+				t.Errorf("%s: %q renders as %q, which contains %q", tt.name, tt.in, html, unwanted)
+			}
+		}
+	}
+}
+
+// TestMixedMathDelimiters renders one document with both --math-delimiters
+// styles, which must not interfere with each other.
+func TestMixedMathDelimiters(t *testing.T) {
+	doc := "Inline \\(a+b\\) and $c+d$, for $5.\n\n\\[\nx^2\n\\]\n\n$$y^2$$\n\n`\\(code\\)` and `$code$`\n"
+	html, err := NewRenderer(WithMath(), WithLatexMathDelimiters()).renderMarkdown([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`<span class="math-inline">a+b</span>`,
+		`<span class="math-inline">c+d</span>`,
+		"for $5.",
+		"<div class=\"math-display\">x^2\n</div>",
+		`<div class="math-display">y^2</div>`,
+		`<code>\(code\)</code> and <code>$code$</code>`,
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("mixed delimiters render as %q, want it to contain %q", html, want)
+		}
+	}
+	if n := strings.Count(html, `class="math-`); n != 4 {
+		t.Errorf("mixed delimiters give %d math elements, want 4: %q", n, html)
+	}
+}
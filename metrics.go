@@ -0,0 +1,27 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Prometheus metrics, registered with the default registry and served from
+// GET /metrics when the daemon runs with --metrics.
+var (
+	renderDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "livemd_render_duration_seconds",
+		Help:    "Time taken by Renderer.Render to turn a file into HTML.",
+		Buckets: prometheus.ExponentialBuckets(0.0005, 2, 14), // 0.5ms to ~4s
+	})
+	connectedClients = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "livemd_connected_clients",
+		Help: "Browsers currently connected over WebSocket or Server-Sent Events.",
+	})
+	broadcastsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "livemd_broadcasts_total",
+		Help: "File updates sent out to browsers.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(renderDuration, connectedClients, broadcastsTotal)
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// multiIndexTemplate is the root page with --serve-multiple: every markdown
+// file under the served directory, linked to its own page.
+var multiIndexTemplate = template.Must(template.New("multi-index").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>{{.Title}}</title>
+    <link rel="icon" href="/favicon.ico">
+    <link rel="stylesheet" href="https://cdn.jsdelivr.net/npm/bulma@1.0.4/css/bulma.min.css">
+    <link rel="stylesheet" href="{{.Static}}style.css">
+    <style>
+        body { display: block; height: auto; overflow: visible; }
+        article { overflow: visible; }
+    </style>
+</head>
+<body>
+    <article class="content" id="content">
+        <h1>{{.Title}}</h1>
+        {{if .Pages}}<table class="table is-fullwidth">
+            <thead><tr><th>File</th><th>Title</th><th>Last modified</th></tr></thead>
+            <tbody>
+{{range .Pages}}                <tr><td><a href="{{.URL}}">{{.Rel}}</a></td><td>{{.Title}}</td><td>{{.LastChange.Format "2006-01-02 15:04"}}</td></tr>
+{{end}}            </tbody>
+        </table>{{else}}<p>No markdown files found.</p>{{end}}
+    </article>
+</body>
+</html>
+`))
+
+// multiPageTemplate is a single file's page with --serve-multiple. It
+// subscribes to updates for its own path only.
+var multiPageTemplate = template.Must(template.New("multi-page").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>{{.Title}}</title>
+    <link rel="icon" href="/favicon.ico">
+    <link rel="stylesheet" href="https://cdn.jsdelivr.net/npm/bulma@1.0.4/css/bulma.min.css">
+    <link rel="stylesheet" href="{{.Static}}style.css">
+    {{.Head}}
+    <style>
+        body { display: block; height: auto; overflow: visible; }
+        article { overflow: visible; }
+    </style>
+</head>
+<body>
+    <article class="content" id="content">{{.HTML}}</article>
+    {{if .Nav}}<nav class="doc-nav">{{with .Nav.Prev}}<a class="doc-nav-prev" href="{{.URL}}">&larr; Previous: {{.Title}}</a>{{end}}{{with .Nav.Next}}<a class="doc-nav-next" href="{{.URL}}">Next: {{.Title}} &rarr;</a>{{end}}</nav>{{end}}
+    {{.WSScript}}
+</body>
+</html>
+`))
+
+// multiPage is one row of the --serve-multiple index.
+type multiPage struct {
+	Rel        string
+	URL        string
+	Title      string
+	LastChange time.Time
+}
+
+// serveMultiple follows root for markdown files and serves each one at
+// /file/<relative path>, with an index of them at / (--serve-multiple).
+func (s *Server) serveMultiple(mux *http.ServeMux, root, headExtra string) {
+	// Only for this run: the folder and its files aren't saved as followed.
+	folder := &WatchedFolder{Path: root, Extensions: []string{".md", ".markdown"}, Recursive: true, Live: true, Unsaved: true}
+	if err := s.hub.FollowFolder(folder); err != nil {
+		s.hub.logger.Warn("--serve-multiple: follow failed", "folder", root, "err", err)
+	}
+
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		var pages []multiPage
+		for _, f := range s.hub.GetFiles() {
+			rel, ok := relativeTo(root, f.Path)
+			if !ok || f.Deleted || !isMarkdown(f.Path) {
+				continue
+			}
+			pages = append(pages, multiPage{
+				Rel:        rel,
+				URL:        "/file/" + rel,
+				Title:      markdownTitle(f),
+				LastChange: f.LastChange,
+			})
+		}
+		sort.Slice(pages, func(i, j int) bool { return pages[i].Rel < pages[j].Rel })
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		multiIndexTemplate.Execute(w, map[string]interface{}{
+			"Title":  filepath.Base(root),
+			"Pages":  pages,
+			"Static": s.opts.StaticPath,
+		})
+	})
+
+	mux.HandleFunc("/file/", func(w http.ResponseWriter, r *http.Request) {
+		rel := strings.TrimPrefix(r.URL.Path, "/file/")
+		path := filepath.Join(root, filepath.FromSlash(rel))
+		if !withinDir(root, path) {
+			http.NotFound(w, r)
+			return
+		}
+		if !isMarkdown(path) {
+			// Images and attachments, which relative links in a page
+			// resolve to.
+			if info, err := os.Stat(path); err != nil || info.IsDir() {
+				http.NotFound(w, r)
+				return
+			}
+			http.ServeFile(w, r, path)
+			return
+		}
+		// Live updates need the file watched; pages stay watched once opened.
+		if err := s.hub.ActivateFile(path); err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		var file *WatchedFile
+		for _, f := range s.hub.GetFiles() {
+			if PathsEqual(f.Path, path) {
+				file = &f
+				break
+			}
+		}
+		if file == nil {
+			http.NotFound(w, r)
+			return
+		}
+		title := file.Title
+		if title == "" {
+			title = file.Name
+		}
+
+		var nav *docNav
+		if s.opts.IncludeNav {
+			nav = s.docNav(root, file.Path, s.opts.NavOrderBy)
+		}
+
+		head := headExtra + s.customCSSLink() + s.injectedHead(fragmentData{
+			Filename: file.Name,
+			Title:    title,
+			Date:     file.LastChange.Format("2006-01-02"),
+		})
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		multiPageTemplate.Execute(w, map[string]interface{}{
+			"Title":    title,
+			"HTML":     template.HTML(file.HTML),
+			"WSScript": liveScript(file.Path, file.HTML, s.opts.WSPath, "content"),
+			"Head":     template.HTML(head),
+			"Nav":      nav,
+			"Static":   s.opts.StaticPath,
+		})
+	})
+	s.hub.logger.Info("Serving markdown files at /file/", "folder", root)
+}
+
+// docNav holds the neighbours of a --serve-multiple page (--include-nav);
+// either may be nil at the ends.
+type docNav struct {
+	Prev, Next *multiPage
+}
+
+// docNav finds the pages before and after path among the markdown files in
+// the same directory, ordered by orderBy: "weight" (front matter weight or
+// order, files without one last, then by name), "date" (oldest first) or
+// "name". It returns nil if path has no neighbours.
+func (s *Server) docNav(root, path, orderBy string) *docNav {
+	type sibling struct {
+		page   multiPage
+		weight int
+		hasW   bool
+	}
+	var siblings []sibling
+	for _, f := range s.hub.GetFiles() {
+		if f.Deleted || !isMarkdown(f.Path) || !PathsEqual(filepath.Dir(f.Path), filepath.Dir(path)) {
+			continue
+		}
+		rel, ok := relativeTo(root, f.Path)
+		if !ok {
+			continue
+		}
+		sib := sibling{page: multiPage{
+			Rel:        rel,
+			URL:        "/file/" + rel,
+			Title:      markdownTitle(f),
+			LastChange: f.LastChange,
+		}}
+		if orderBy == "weight" {
+			if content, err := os.ReadFile(f.Path); err == nil {
+				front, _ := splitFrontMatter(content)
+				sib.weight, sib.hasW = frontMatterWeight(front)
+			}
+		}
+		siblings = append(siblings, sib)
+	}
+	sort.SliceStable(siblings, func(i, j int) bool {
+		a, b := siblings[i], siblings[j]
+		switch orderBy {
+		case "weight":
+			if a.hasW != b.hasW {
+				return a.hasW
+			}
+			if a.weight != b.weight {
+				return a.weight < b.weight
+			}
+		case "date":
+			if !a.page.LastChange.Equal(b.page.LastChange) {
+				return a.page.LastChange.Before(b.page.LastChange)
+			}
+		}
+		return a.page.Rel < b.page.Rel
+	})
+
+	for i, sib := range siblings {
+		if !PathsEqual(filepath.Join(root, filepath.FromSlash(sib.page.Rel)), path) {
+			continue
+		}
+		nav := &docNav{}
+		if i > 0 {
+			nav.Prev = &siblings[i-1].page
+		}
+		if i+1 < len(siblings) {
+			nav.Next = &siblings[i+1].page
+		}
+		if nav.Prev == nil && nav.Next == nil {
+			return nil
+		}
+		return nav
+	}
+	return nil
+}
+
+// relativeTo returns path relative to root with forward slashes, and false
+// if path is outside root.
+func relativeTo(root, path string) (string, bool) {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// markdownTitle names a markdown file for the --serve-multiple index: its
+// front matter title, else its first heading, else its file name.
+func markdownTitle(f WatchedFile) string {
+	if f.Title != "" {
+		return f.Title
+	}
+	if title := firstH1Text(f.HTML); title != "" {
+		return title
+	}
+	return f.Name
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestServeMultipleIsNotSaved(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "a.md"), "---\ntitle: Front Title\n---\n# Heading\n")
+	writeFile(t, filepath.Join(root, "b.md"), "# B Heading\n")
+	opts := testOptions()
+	opts.ServeMultiple = root
+	s, ts := startTestServer(t, opts)
+
+	// Anything else that saves the state must still leave the folder out.
+	other := filepath.Join(t.TempDir(), "other.md")
+	writeFile(t, other, "# Other\n")
+	if err := s.hub.AddFile(other); err != nil {
+		t.Fatal(err)
+	}
+	state, err := loadState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Folders) != 0 {
+		t.Errorf("saved folders = %+v, want none", state.Folders)
+	}
+	if len(state.Files) != 1 || state.Files[0].Path != other {
+		t.Errorf("saved files = %+v, want only %s", state.Files, other)
+	}
+
+	resp, err := http.Get(ts.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	for _, title := range []string{"Front Title", "B Heading"} {
+		if !strings.Contains(string(body), title) {
+			t.Errorf("index doesn't list the title %q", title)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ServerOptions holds the `livemd start` flags that shape how the daemon serves
+// files. cmdStart fills it in from the command line and StartServer threads it
+// through to the HTTP handlers.
+type ServerOptions struct {
+	ServerName       string // value of the Server response header
+	HideServerHeader bool   // omit the Server header entirely
+	AuthUser         string // with AuthPassword, require HTTP Basic auth; "" = open
+	AuthPassword     string
+	ServeDir         bool   // expose ServeDirRoot at /files/
+	ServeDirRoot     string // absolute root for /files/ (defaults to the start directory)
+	PingEndpoint     bool   // register GET /ping
+	NoHealth         bool   // don't register GET /health
+	Metrics          bool   // register GET /metrics for Prometheus
+	LinkRules        []linkRewriteRule
+	WatchAll         bool              // serve static/ from disk and reload browsers when it changes
+	StaticDir        string            // absolute path of the on-disk static/ used by WatchAll
+	LanguageMap      map[string]string // lowercase fence language -> chroma lexer name
+	NoUnsafe         bool              // omit raw HTML from markdown
+	AllowScript      bool              // with NoUnsafe, keep <script>/<style>
+	TableClass       string            // class attribute for markdown tables
+	TableWrapper     bool              // wrap markdown tables in div.table-wrapper
+	FaviconFile      string            // icon served at /favicon.ico instead of the embedded one
+	ClientTimeout    time.Duration     // drop WebSocket clients silent for this long
+	PingInterval     time.Duration     // how often each WebSocket client is pinged
+	NoWSCompress     bool              // don't offer permessage-deflate to WebSocket clients
+	ShutdownGrace    time.Duration     // how long browsers have to get the shutdown message before the listener closes
+	Bind             string            // IP address to listen on; "" = all interfaces
+	Socket           string            // absolute path of a Unix socket to listen on instead of a TCP port
+	DocCharset       *docCharset       // input encoding of text documents; nil = UTF-8
+	HighlightInline  bool              // highlight `lang:code` inline code spans
+	ReloadStrategy   string            // how browsers apply updates: replace, patch or reload
+	Incremental      bool              // send updates as patches against the previous HTML
+	ServePDF         bool              // register GET /pdf (headless Chromium)
+	PDFPageSize      string            // CSS @page size, e.g. A4 or Letter
+	PDFMargins       string            // CSS @page margin, e.g. 1cm or "15mm 10mm"
+	PrerenderPDF     bool              // print on every change and cache the result
+
+	// File watching
+	WatchNetworkDrive bool          // poll files on network drives (Windows)
+	Poll              bool          // poll every file instead of using change events
+	PollInterval      time.Duration // how often polled files are checked
+	WatchCreateOnly   bool          // react only to new files in followed folders
+	WatchOnDemand     bool          // watch only while a browser is connected
+
+	RetryWatch     int           // consecutive watcher errors before it is recreated; 0 = never
+	WatchTimeout   time.Duration // limit on subscribing to a file's changes; 0 = none
+	WatchParentDir bool          // also watch each file's directory for recreation
+	WatchSymlinks  bool          // notice symlinks in a file's path being repointed
+	Debounce       time.Duration // quiet time after a file's last write before it is rendered
+
+	MaxConcurrentRenders int // file changes rendered at once; 0 = unlimited
+
+	ServeMultiple string // directory whose markdown files get a page each at /file/; "" = off
+	IncludeNav    bool   // previous/next links on --serve-multiple pages
+	NavOrderBy    string // order of those links: weight, date or name
+
+	TrimHTML bool // minify rendered HTML before sending it to browsers
+	Verbose  bool // extra diagnostic log lines
+	LogJSON  bool // log as JSON lines on stderr, hub log entries included
+
+	TitleFromH1 bool // use a document's first <h1> as its page title
+
+	GlobalHeader string // HTML template file prepended to rendered markdown
+	GlobalFooter string // HTML template file appended to rendered markdown
+	InjectHead   string // HTML template file added to the page <head>
+	CustomCSS    string // stylesheet served at /custom.css and linked from every page
+	PageTemplate string // HTML template file served at / instead of the sidebar page
+
+	HighlightThemeLight string // chroma style for code (light mode with a dark theme set)
+	HighlightThemeDark  string // chroma style for prefers-color-scheme: dark; "" = none
+
+	HighlightCopyExclude string // CSS selector of code block parts not copied, e.g. prompts
+
+	PrintAST bool // dump each parsed markdown AST to stderr
+
+	MathDelimiters string // math syntax in markdown: dollar or latex
+	Math           bool   // parse math on the server instead of scanning text for $ in the browser
+
+	TOC      bool // put a table of contents at the top of rendered markdown
+	TOCDepth int  // deepest heading level in it, 1-6
+
+	HeadingIDPrefix bool // prefix heading ids with a hash of the section they're in
+
+	NoEmoji     bool // leave :shortcode: emoji as text
+	NoFootnotes bool // leave [^1] footnotes as text
+
+	NoLocalFiles bool // don't serve files next to watched markdown at /file/
+	IncludeDepth int  // nesting limit of <!-- include: --> directives; 0 = off
+
+	PlantUMLURL string // PlantUML server drawing ```plantuml``` fences
+	PlantUMLJar string // absolute path of a plantuml.jar drawing them instead
+
+	MaxSize    int64 // files larger than this many bytes aren't rendered; 0 = no limit
+	CheckLinks bool  // mark relative links to missing files in rendered markdown
+
+	CacheDir     string // persist rendered markdown here; "" = no cache
+	CacheMaxSize int64  // bytes of cached HTML to keep; 0 = unlimited
+
+	ConnectionLimitPerIP int // WebSocket connections allowed per remote IP; 0 = unlimited
+
+	WSPath     string // WebSocket endpoint, default /ws
+	StaticPath string // mount point of static/, with a trailing slash; default /static/
+
+	ScrollMargin int // pixels left above a heading scrolled to, for sticky headers
+
+	OpenBrowser bool // open the UI in the default browser once the server is listening
+
+	WordCountThreshold int // warn in the browser about markdown longer than this; 0 = off
+
+	LiveCursor bool // show browsers where the others viewing a file are scrolled to
+	MaxCursors int  // with LiveCursor, positions shown at once; 0 = all
+
+	LastModifiedHeader bool // add a content-hash ETag to /raw and /api/content, for 304 Not Modified
+
+	TLSCert       string // PEM certificate file; with TLSKey, serve HTTPS
+	TLSKey        string // PEM private key file
+	TLSSelfSigned bool   // serve HTTPS with a generated, untrusted certificate
+}
+
+// boundHost is the --bind address, or "" when the server listens on every
+// interface (no --bind, 0.0.0.0 or ::).
+func (o *ServerOptions) boundHost() string {
+	if ip := net.ParseIP(o.Bind); ip == nil || ip.IsUnspecified() {
+		return ""
+	}
+	return o.Bind
+}
+
+// lockHost is what the lock file records for CLI commands to reach the
+// server at: "unix:" and the --socket path, or the --bind address.
+func (o *ServerOptions) lockHost() string {
+	if o.Socket != "" {
+		return "unix:" + o.Socket
+	}
+	return o.boundHost()
+}
+
+// localAddr is the host:port this machine reaches the server at.
+func (o *ServerOptions) localAddr(port int) string {
+	host := o.boundHost()
+	if host == "" {
+		host = "localhost"
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+// scheme is the URL scheme the server is reached at.
+func (o *ServerOptions) scheme() string {
+	if o.TLSCert != "" || o.TLSSelfSigned {
+		return "https"
+	}
+	return "http"
+}
+
+// servesLocalFiles reports whether /file/ serves the files next to watched
+// markdown. --serve-multiple has its own /file/ pages, under which relative
+// links already resolve to the right place.
+func (o *ServerOptions) servesLocalFiles() bool {
+	return !o.NoLocalFiles && o.ServeMultiple == ""
+}
+
+// rendererOptions translates the render-related flags into RendererOptions.
+func (o *ServerOptions) rendererOptions() []RendererOption {
+	var opts []RendererOption
+	if len(o.LinkRules) > 0 {
+		opts = append(opts, WithLinkRewriteRules(o.LinkRules))
+	}
+	if len(o.LanguageMap) > 0 {
+		opts = append(opts, WithLanguageMap(o.LanguageMap))
+	}
+	if o.NoUnsafe {
+		opts = append(opts, WithSafeHTML(o.AllowScript))
+	}
+	if o.TableClass != "" {
+		opts = append(opts, WithTableClass(o.TableClass))
+	}
+	if o.TableWrapper {
+		opts = append(opts, WithTableWrapper())
+	}
+	if o.HighlightInline {
+		opts = append(opts, WithInlineHighlighting())
+	}
+	if o.GlobalHeader != "" {
+		opts = append(opts, WithGlobalHeader(o.GlobalHeader))
+	}
+	if o.GlobalFooter != "" {
+		opts = append(opts, WithGlobalFooter(o.GlobalFooter))
+	}
+	if o.HighlightThemeLight != "" {
+		opts = append(opts, WithHighlightTheme(o.HighlightThemeLight))
+	}
+	if o.HighlightThemeDark != "" {
+		opts = append(opts, WithHighlightClasses())
+	}
+	if o.PrintAST {
+		opts = append(opts, WithASTDump(os.Stderr))
+	}
+	if o.MathDelimiters == "latex" {
+		opts = append(opts, WithLatexMathDelimiters())
+	}
+	if o.Math {
+		opts = append(opts, WithMath())
+	}
+	if o.TOC {
+		opts = append(opts, WithTOC(o.TOCDepth))
+	}
+	if o.HeadingIDPrefix {
+		opts = append(opts, WithHeadingIDPrefix())
+	}
+	if o.NoEmoji {
+		opts = append(opts, WithoutEmoji())
+	}
+	if o.NoFootnotes {
+		opts = append(opts, WithoutFootnotes())
+	}
+	opts = append(opts, WithIncludeDepth(o.IncludeDepth))
+	if o.PlantUMLURL != "" || o.PlantUMLJar != "" {
+		opts = append(opts, WithPlantUML(o.PlantUMLURL, o.PlantUMLJar))
+	}
+	if o.servesLocalFiles() {
+		opts = append(opts, WithLocalFileLinks())
+	}
+	opts = append(opts, WithMaxFileSize(o.MaxSize))
+	if o.CheckLinks {
+		opts = append(opts, WithLinkCheck())
+	}
+	if o.CacheDir != "" {
+		opts = append(opts, WithRenderCache(o.CacheDir, o.CacheMaxSize))
+	}
+	if o.DocCharset != nil {
+		opts = append(opts, WithDocCharset(o.DocCharset))
+	}
+	return opts
+}
+
+// stringList is a repeatable string flag: each occurrence appends a value.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
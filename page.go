@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"html/template"
+	"io"
+	"io/fs"
+	"net/http"
+	"strings"
+)
+
+// pageData is what page templates can use: static/index.html, and the
+// --template file that replaces it. Content and WSScript only make sense in
+// the latter, which shows a single document.
+type pageData struct {
+	Content  template.HTML // the rendered document, in <div id="livemd-content">
+	Filename string        // base name of the document
+	Title    string        // page title: first heading or file name
+	WSScript template.HTML // <script> that keeps Content up to date
+	Port     int           // port the server listens on
+	Head     template.HTML // markup for <head> from --css, --inject-head, ...
+	Static   string        // where frontend assets are served, e.g. /static/
+}
+
+// liveContentID is the id of the element wrapping Content in a --template
+// page, which WSScript replaces the content of.
+const liveContentID = "livemd-content"
+
+// liveScriptTemplate is the script of single-document pages (--serve-multiple
+// and --template): it subscribes to updates of one file and swaps them into
+// the target element, applying --incremental patches, fetches the --css
+// stylesheet again when it changes and says so when the server shuts down.
+// With no path it follows every file.
+var liveScriptTemplate = template.Must(template.New("live-script").Parse(`<script>
+    (function () {
+        var path = {{.Path}}, target = {{.Target}};
+        var html = {{.HTML}}, hash = {{.Hash}}; // what the target was rendered from
+        function show(file, newHash) {
+            html = file.html;
+            hash = newHash;
+            document.getElementById(target).innerHTML = html;
+            document.title = file.title || file.name;
+        }
+        // --incremental: apply a patch (Op in patch.go) to html.
+        function patched(patch) {
+            var out = '', pos = 0;
+            patch.forEach(function (op) {
+                if (op.r) { out += html.slice(pos, pos + op.r); pos += op.r; }
+                else if (op.d) { pos += op.d; }
+                else if (op.i) { out += op.i; }
+            });
+            return out + html.slice(pos);
+        }
+        function connect() {
+            var scheme = location.protocol === 'https:' ? 'wss://' : 'ws://';
+            var ws = new WebSocket(scheme + location.host + {{.WSPath}} + (path ? '?path=' + encodeURIComponent(path) : ''));
+            ws.onmessage = function (e) {
+                var msg = JSON.parse(e.data);
+                if (msg.type === 'reload' && msg.reload === 'css') {
+                    var link = document.getElementById('livemd-custom-css');
+                    if (link) link.href = '/custom.css?v=' + Date.now().toString(36);
+                    return;
+                }
+                if (msg.type === 'shutdown') {
+                    var banner = document.createElement('div');
+                    banner.textContent = msg.error + ' (click to dismiss)';
+                    banner.style.cssText = 'position:fixed;top:0;left:0;right:0;z-index:1000;padding:6px 16px;' +
+                        'background:#feecf0;color:#cc0f35;font:12px sans-serif;cursor:pointer';
+                    banner.onclick = function () { banner.remove(); };
+                    document.body.appendChild(banner);
+                    return;
+                }
+                if (msg.type !== 'update' || !msg.file || (path && msg.file.path !== path)) return;
+                if (!msg.patch) {
+                    show(msg.file, msg.hash);
+                } else if (msg.base === hash) {
+                    msg.file.html = patched(msg.patch);
+                    show(msg.file, msg.hash);
+                } else {
+                    fetch('/api/content?path=' + encodeURIComponent(msg.file.path)).then(function (res) { return res.json(); })
+                        .then(function (m) { if (m.file) show(m.file, m.hash); });
+                }
+            };
+            ws.onclose = function () { setTimeout(connect, 1000); };
+        }
+        connect();
+    })();
+    </script>`))
+
+// liveScript renders liveScriptTemplate for the page of path, whose element
+// target currently shows html.
+func liveScript(path, html, wsPath, target string) template.HTML {
+	var buf bytes.Buffer
+	liveScriptTemplate.Execute(&buf, map[string]interface{}{
+		"Path":   path,
+		"Target": target,
+		"HTML":   template.HTML(html),
+		"Hash":   contentHash([]byte(html)),
+		"WSPath": wsPath,
+	})
+	return template.HTML(buf.String())
+}
+
+// executePage writes a page template executed with data, or a 500 if it
+// fails, so a broken template doesn't send half a page. execute is the
+// template's Execute method.
+func executePage(w http.ResponseWriter, execute func(io.Writer, interface{}) error, data pageData) {
+	var buf bytes.Buffer
+	if err := execute(&buf, data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(buf.Bytes())
+}
+
+// servePage serves the --template page at /, showing ?path= or else the file
+// that changed last, like /api/content. Before any file is watched it is
+// empty and follows whichever file changes.
+func (s *Server) servePage(w http.ResponseWriter, r *http.Request, headExtra string) {
+	requested := r.URL.Query().Get("path")
+	file, found, err := s.fileContent(requested)
+	if !found && requested != "" {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	title := file.Title
+	if title == "" {
+		title = file.Name
+	}
+	data := pageData{
+		Content:  template.HTML(`<div id="` + liveContentID + `">` + file.HTML + `</div>`),
+		Filename: file.Name,
+		Title:    title,
+		WSScript: liveScript(file.Path, file.HTML, s.opts.WSPath, liveContentID),
+		Port:     s.port,
+		Static:   s.opts.StaticPath,
+	}
+	data.Head = template.HTML(headExtra + s.customCSSLink() + s.injectedHead(fragmentData{
+		Filename: file.Name,
+		Title:    title,
+		Date:     file.LastChange.Format("2006-01-02"),
+	}))
+	executePage(w, s.page.execute, data)
+}
+
+// indexTemplate parses static/index.html from staticFS, which is read from
+// disk on every request with --watch-all.
+func indexTemplate(staticFS fs.FS) (*template.Template, error) {
+	src, err := fs.ReadFile(staticFS, "index.html")
+	if err != nil {
+		return nil, err
+	}
+	return template.New("index.html").Parse(string(src))
+}
+
+// Placeholders checkPageTemplate renders a --template with, to find them in
+// the output.
+const (
+	contentProbe  = "livemd-content-probe"
+	wsScriptProbe = "livemd-ws-script-probe"
+)
+
+// checkPageTemplate reports whether the --template file at path parses and
+// places both {{.Content}} and {{.WSScript}}, without which it would never
+// show the document or its updates.
+func checkPageTemplate(path string) error {
+	var buf bytes.Buffer
+	err := newHTMLFragment(path).execute(&buf, pageData{
+		Content:  contentProbe,
+		WSScript: wsScriptProbe,
+		Static:   defaultStaticPath,
+	})
+	if err != nil {
+		return err
+	}
+	var missing []string
+	if !strings.Contains(buf.String(), contentProbe) {
+		missing = append(missing, "{{.Content}}")
+	}
+	if !strings.Contains(buf.String(), wsScriptProbe) {
+		missing = append(missing, "{{.WSScript}}")
+	}
+	if len(missing) > 0 {
+		return errors.New("template doesn't use " + strings.Join(missing, " or "))
+	}
+	return nil
+}
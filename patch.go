@@ -0,0 +1,57 @@
+package main
+
+import (
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// Op is one step of a Message.Patch (--incremental). Applied in order to the
+// HTML a browser was last sent, each keeps (Retain) or drops (Delete) the
+// next characters, or inserts Text in their place; whatever is left after
+// the last op is kept. Lengths count UTF-16 code units, as JavaScript
+// strings do.
+type Op struct {
+	Retain int    `json:"r,omitempty"`
+	Delete int    `json:"d,omitempty"`
+	Insert string `json:"i,omitempty"`
+}
+
+// diffHTML computes the patch that turns base into html. It returns false
+// when the patch wouldn't be smaller than html itself, e.g. for a rewrite,
+// and the whole HTML should be sent instead.
+func diffHTML(base, html string) ([]Op, bool) {
+	dmp := diffmatchpatch.New()
+	diffs := dmp.DiffCleanupEfficiency(dmp.DiffMain(base, html, true))
+
+	var patch []Op
+	size := 0
+	for _, d := range diffs {
+		switch d.Type {
+		case diffmatchpatch.DiffEqual:
+			patch = append(patch, Op{Retain: utf16Len(d.Text)})
+			size += 8
+		case diffmatchpatch.DiffDelete:
+			patch = append(patch, Op{Delete: utf16Len(d.Text)})
+			size += 8
+		case diffmatchpatch.DiffInsert:
+			patch = append(patch, Op{Insert: d.Text})
+			size += 8 + len(d.Text)
+		}
+	}
+	if n := len(patch); n > 0 && patch[n-1].Retain > 0 {
+		patch = patch[:n-1] // the rest is kept anyway
+	}
+	return patch, size < len(html)
+}
+
+// utf16Len is the length of s in UTF-16 code units.
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		if r >= 0x10000 {
+			n += 2 // surrogate pair
+		} else {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// errNoChromium is returned by pdfPrinter.Print when no Chromium-based
+// browser was found at startup.
+var errNoChromium = errors.New("no Chromium or Chrome executable found; install chromium (or google-chrome) and restart livemd to enable /pdf")
+
+// chromiumCandidates are the executables tried, in order, to print PDFs.
+var chromiumCandidates = []string{
+	"chromium",
+	"chromium-browser",
+	"google-chrome",
+	"google-chrome-stable",
+	"chrome",
+	"msedge",
+	"/Applications/Chromium.app/Contents/MacOS/Chromium",
+	"/Applications/Google Chrome.app/Contents/MacOS/Google Chrome",
+	`C:\Program Files\Google\Chrome\Application\chrome.exe`,
+	`C:\Program Files (x86)\Microsoft\Edge\Application\msedge.exe`,
+}
+
+func findChromium() string {
+	for _, name := range chromiumCandidates {
+		if path, err := exec.LookPath(name); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// printTemplate is the page Chromium prints: the rendered file inside the same
+// <article> and stylesheets as the browser view, with the app layout's
+// fixed-height body undone so content flows across pages. <base> points at the
+// running server so /static and /raw URLs resolve.
+var printTemplate = template.Must(template.New("print").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <base href="{{.BaseURL}}">
+    <title>{{.Title}}</title>
+    <link rel="stylesheet" href="https://cdn.jsdelivr.net/npm/bulma@1.0.4/css/bulma.min.css">
+    <link rel="stylesheet" href="{{.Static}}style.css">
+    {{if .ChromaCSS}}<link rel="stylesheet" href="/chroma.css">{{end}}
+    <style>
+        @page { size: {{.PageSize}}; margin: {{.Margins}}; }
+        body { display: block; height: auto; overflow: visible; }
+        article { overflow: visible; }
+    </style>
+</head>
+<body>
+    <article class="content" id="content">{{.HTML}}</article>
+</body>
+</html>
+`))
+
+// pdfPrinter turns rendered files into PDFs with headless Chromium
+// (--serve-pdf). With prerender set, a PDF is printed on every change and
+// cached so GET /pdf returns immediately.
+type pdfPrinter struct {
+	browser   string
+	baseURL   string
+	pageSize  template.CSS
+	margins   template.CSS
+	prerender bool
+	chromaCSS bool // code uses CSS classes (--highlight-theme-dark); print in the light theme
+
+	staticPath string // where the server mounts static/ (--static-path)
+	insecure   bool   // assets come over TLS, whose certificate may not cover localhost
+
+	mu       sync.Mutex
+	cache    map[string]cachedPDF
+	queued   map[string]string // path -> latest HTML waiting to be prerendered
+	printing map[string]bool   // paths with a prerender running
+}
+
+// cachedPDF is a prerendered PDF and the HTML it was printed from, so a stale
+// entry (the file changed while no print ran) is never served.
+type cachedPDF struct {
+	html string
+	pdf  []byte
+}
+
+func newPDFPrinter(opts *ServerOptions, port int) *pdfPrinter {
+	return &pdfPrinter{
+		browser:   findChromium(),
+		baseURL:   fmt.Sprintf("%s://%s/", opts.scheme(), opts.localAddr(port)),
+		pageSize:  template.CSS(opts.PDFPageSize),
+		margins:   template.CSS(opts.PDFMargins),
+		prerender: opts.PrerenderPDF,
+		chromaCSS: opts.HighlightThemeDark != "",
+		cache:     make(map[string]cachedPDF),
+		queued:    make(map[string]string),
+		printing:  make(map[string]bool),
+
+		staticPath: opts.StaticPath,
+		insecure:   opts.scheme() == "https",
+	}
+}
+
+// Available reports whether a browser to print with was found.
+func (p *pdfPrinter) Available() bool {
+	return p.browser != ""
+}
+
+// Cached returns the prerendered PDF of path if it was printed from html.
+func (p *pdfPrinter) Cached(path, html string) ([]byte, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	c, ok := p.cache[path]
+	if !ok || c.html != html {
+		return nil, false
+	}
+	return c.pdf, true
+}
+
+// Queue records html as the latest render of path to prerender. It reports
+// true if the caller should start printing path, taking each HTML from Next,
+// and false if a print of path is already running and will pick it up.
+func (p *pdfPrinter) Queue(path, html string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.queued[path] = html
+	if p.printing[path] {
+		return false
+	}
+	p.printing[path] = true
+	return true
+}
+
+// Next returns the HTML queued for path since the last call, or false once
+// there is none, after which the next Queue of path starts over.
+func (p *pdfPrinter) Next(path string) (string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	html, ok := p.queued[path]
+	if !ok {
+		delete(p.printing, path)
+		return "", false
+	}
+	delete(p.queued, path)
+	return html, true
+}
+
+// Update reprints path after a change when prerendering is enabled.
+func (p *pdfPrinter) Update(path, html string) error {
+	if !p.prerender || !p.Available() {
+		return nil
+	}
+	pdf, err := p.Print(path, html)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	p.cache[path] = cachedPDF{html: html, pdf: pdf}
+	p.mu.Unlock()
+	return nil
+}
+
+// Print renders html (the rendered content of path) to a PDF.
+func (p *pdfPrinter) Print(path, html string) ([]byte, error) {
+	if !p.Available() {
+		return nil, errNoChromium
+	}
+
+	dir, err := os.MkdirTemp("", "livemd-pdf-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	page, err := os.Create(filepath.Join(dir, "page.html"))
+	if err != nil {
+		return nil, err
+	}
+	err = printTemplate.Execute(page, map[string]interface{}{
+		"BaseURL":   p.baseURL,
+		"Title":     filepath.Base(path),
+		"PageSize":  p.pageSize,
+		"Margins":   p.margins,
+		"ChromaCSS": p.chromaCSS,
+		"HTML":      template.HTML(html),
+		"Static":    p.staticPath,
+	})
+	page.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	out := filepath.Join(dir, "page.pdf")
+	args := []string{
+		"--headless",
+		"--disable-gpu",
+		"--no-pdf-header-footer",
+		"--virtual-time-budget=2000", // let stylesheets and images load
+		"--print-to-pdf=" + out,
+	}
+	if runtime.GOOS != "windows" && os.Geteuid() == 0 {
+		args = append(args, "--no-sandbox") // Chromium refuses to run as root otherwise
+	}
+	if p.insecure {
+		args = append(args, "--ignore-certificate-errors")
+	}
+	args = append(args, "file://"+filepath.ToSlash(page.Name()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	if output, err := exec.CommandContext(ctx, p.browser, args...).CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("%s: %v: %s", filepath.Base(p.browser), err, output)
+	}
+	return os.ReadFile(out)
+}
+
+// cssLengthListPattern accepts --pdf-page-size/--pdf-margins values: words and
+// lengths separated by spaces, nothing that could end the CSS rule.
+var cssLengthListPattern = regexp.MustCompile(`^[A-Za-z0-9.% ]+$`)
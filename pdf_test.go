@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+func TestPrerenderQueueKeepsLatest(t *testing.T) {
+	p := newPDFPrinter(testOptions(), 0)
+	if !p.Queue("a.md", "<p>1</p>") {
+		t.Fatal("the first change didn't start a print")
+	}
+	if html, ok := p.Next("a.md"); !ok || html != "<p>1</p>" {
+		t.Fatalf("Next = %q, %v; want the first HTML", html, ok)
+	}
+
+	// Saves while a.md prints wait for it, and only the last one counts.
+	if p.Queue("a.md", "<p>2</p>") || p.Queue("a.md", "<p>3</p>") {
+		t.Fatal("a change during a print started another one")
+	}
+	if !p.Queue("b.md", "<p>b</p>") {
+		t.Error("a change to another file waited for a.md")
+	}
+	if html, ok := p.Next("a.md"); !ok || html != "<p>3</p>" {
+		t.Errorf("Next = %q, %v; want the latest HTML", html, ok)
+	}
+	if _, ok := p.Next("a.md"); ok {
+		t.Error("Next returned HTML twice")
+	}
+	if !p.Queue("a.md", "<p>4</p>") {
+		t.Error("a change after the print finished didn't start a new one")
+	}
+}
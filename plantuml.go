@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// plantUMLTimeout bounds one diagram, including the JVM startup of
+// --plantuml-jar. A document waits for its diagrams, so this is kept short:
+// an unreachable server shouldn't stall the preview.
+const plantUMLTimeout = 5 * time.Second
+
+// plantUMLCacheSize is how many rendered diagrams a plantUML keeps, so
+// re-rendering a document doesn't draw its unchanged diagrams again.
+const plantUMLCacheSize = 256
+
+// plantUML draws ```plantuml``` fences as SVG, with a PlantUML server
+// (--plantuml-url) or a local plantuml.jar (--plantuml-jar).
+type plantUML struct {
+	url    string // base URL of a PlantUML server, e.g. http://localhost:8080
+	jar    string // path of plantuml.jar, run with java
+	client *http.Client
+
+	mu    sync.Mutex
+	cache map[string]string // diagram source -> SVG
+}
+
+func newPlantUML(serverURL, jar string) *plantUML {
+	return &plantUML{
+		url:    strings.TrimSuffix(serverURL, "/"),
+		jar:    jar,
+		client: &http.Client{Timeout: plantUMLTimeout},
+		cache:  make(map[string]string),
+	}
+}
+
+// checkPlantUML reports what is wrong with --plantuml-url and --plantuml-jar,
+// which are alternatives.
+func checkPlantUML(serverURL, jar string) error {
+	if serverURL != "" && jar != "" {
+		return errors.New("--plantuml-url and --plantuml-jar can't be used together")
+	}
+	if serverURL != "" {
+		u, err := url.Parse(serverURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("--plantuml-url must be an http:// or https:// URL, not %q", serverURL)
+		}
+	}
+	if jar != "" {
+		if _, err := exec.LookPath("java"); err != nil {
+			return errors.New("--plantuml-jar needs java on the PATH")
+		}
+	}
+	return nil
+}
+
+// isPlantUML reports whether a fence language is PlantUML.
+func isPlantUML(lang string) bool {
+	lang = strings.ToLower(lang)
+	return lang == "plantuml" || lang == "puml"
+}
+
+// diagramError is PlantUML rejecting a diagram, e.g. for a syntax error. Any
+// other failure, such as the server being down, may pass on a retry.
+type diagramError struct{ msg string }
+
+func (e *diagramError) Error() string { return e.msg }
+
+// render returns the diagram of source as an <img> with the SVG inline, or
+// the reason PlantUML couldn't draw it as a message to show in its place.
+// final is false when that reason wasn't the diagram itself, so the page
+// mustn't be cached.
+func (p *plantUML) render(source []byte) (markup string, final bool) {
+	svg, err := p.svg(source)
+	if err != nil {
+		var rejected *diagramError
+		return `<pre class="plantuml-error">PlantUML: ` + html.EscapeString(err.Error()) + "</pre>\n",
+			errors.As(err, &rejected)
+	}
+	return `<div class="plantuml"><img src="data:image/svg+xml;base64,` +
+		base64.StdEncoding.EncodeToString([]byte(svg)) + `" alt="PlantUML diagram"></div>` + "\n", true
+}
+
+// svg draws source, from the cache if it was drawn before.
+func (p *plantUML) svg(source []byte) (string, error) {
+	key := string(source)
+	p.mu.Lock()
+	svg, ok := p.cache[key]
+	p.mu.Unlock()
+	if ok {
+		return svg, nil
+	}
+
+	var err error
+	if p.url != "" {
+		svg, err = p.fromServer(source)
+	} else {
+		svg, err = p.fromJar(source)
+	}
+	if err != nil {
+		return "", err
+	}
+	p.mu.Lock()
+	if len(p.cache) >= plantUMLCacheSize {
+		p.cache = make(map[string]string)
+	}
+	p.cache[key] = svg
+	p.mu.Unlock()
+	return svg, nil
+}
+
+// fromServer POSTs source to the server's /svg endpoint. A diagram with
+// errors comes back as a 400, with the error in X-PlantUML-Diagram-Error.
+func (p *plantUML) fromServer(source []byte) (string, error) {
+	resp, err := p.client.Post(p.url+"/svg", "text/plain; charset=utf-8", bytes.NewReader(source))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 16<<20))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		if msg := resp.Header.Get("X-PlantUML-Diagram-Error"); msg != "" {
+			if line := resp.Header.Get("X-PlantUML-Diagram-Error-Line"); line != "" {
+				msg = fmt.Sprintf("line %s: %s", line, msg)
+			}
+			return "", &diagramError{msg}
+		}
+		return "", fmt.Errorf("%s answered %s", p.url, resp.Status)
+	}
+	return string(body), nil
+}
+
+// fromJar pipes source through "java -jar plantuml.jar", which exits
+// non-zero and says why on stderr when the diagram has errors.
+func (p *plantUML) fromJar(source []byte) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), plantUMLTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "java", "-Djava.awt.headless=true", "-jar", p.jar,
+		"-pipe", "-tsvg", "-charset", "UTF-8", "-failfast2")
+	cmd.Stdin = bytes.NewReader(source)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return "", fmt.Errorf("plantuml.jar took longer than %s", plantUMLTimeout)
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", &diagramError{msg}
+		}
+		return "", err
+	}
+	return stdout.String(), nil
+}
+
+// plantUMLMissing is put before a ```plantuml``` fence, shown as code, when
+// neither --plantuml-url nor --plantuml-jar is set.
+const plantUMLMissing = "<!-- livemd: PlantUML diagrams need --plantuml-url or --plantuml-jar -->\n"
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/skip2/go-qrcode"
+)
+
+// lanURL is the address other devices on the network open the server at: the
+// --bind address, else this machine's first LAN address, else localhost.
+func (s *Server) lanURL() string {
+	host := s.opts.boundHost()
+	if host == "" {
+		host = "localhost"
+		if addrs := getNetworkAddresses(); len(addrs) > 0 {
+			host = addrs[0]
+		}
+	}
+	return fmt.Sprintf("%s://%s/", s.opts.scheme(), net.JoinHostPort(host, strconv.Itoa(s.port)))
+}
+
+// handleQR serves GET /qr, a PNG QR code of lanURL for opening livemd on a
+// phone. It is drawn on every request, so it follows the network the laptop
+// is on.
+func (s *Server) handleQR(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	png, err := qrcode.Encode(s.lanURL(), qrcode.Medium, 256)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(png)
+}
@@ -9,7 +9,9 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
+	"time"
 	"unicode/utf8"
 
 	"github.com/alecthomas/chroma/v2"
@@ -20,58 +22,440 @@ import (
 	highlighting "github.com/yuin/goldmark-highlighting/v2"
 	"github.com/yuin/goldmark/ast"
 	"github.com/yuin/goldmark/extension"
+	east "github.com/yuin/goldmark/extension/ast"
 	"github.com/yuin/goldmark/parser"
 	"github.com/yuin/goldmark/renderer"
 	goldmarkhtml "github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
 	"github.com/yuin/goldmark/util"
+	xhtml "golang.org/x/net/html"
+	"gopkg.in/yaml.v3"
 )
 
 const maxLines = 1000
 
 // Renderer converts files to HTML
 type Renderer struct {
-	md goldmark.Markdown
+	md          goldmark.Markdown
+	linkRules   []linkRewriteRule
+	languageMap map[string]string // lowercase fence language -> chroma lexer name
+	safeHTML    bool              // omit raw HTML instead of passing it through
+	allowScript bool              // with safeHTML, still pass <script>/<style> through
+	tableClass  string            // class attribute for every <table>
+	tableWrap   bool              // wrap tables in <div class="table-wrapper">
+	charset     *docCharset       // input encoding of text documents; nil = UTF-8
+	inlineCode  bool              // highlight `lang:code` inline code spans
+	header      *htmlFragment     // --global-header, prepended to markdown
+	footer      *htmlFragment     // --global-footer, appended to markdown
+	theme       string            // chroma style for inline-styled highlighting
+	classes     bool              // emit chroma CSS classes instead of inline styles
+	astOut      io.Writer         // --print-ast destination; nil = off
+	latexMath   bool              // rewrite \(…\) and \[…\] math to $ delimiters
+	math        bool              // parse $ math into KaTeX targets (--math)
+	tocDepth    int               // --toc: deepest heading level listed; 0 = no TOC
+	sectionIDs  bool              // prefix heading ids with a hash of their section (--heading-id-prefix)
+	noEmoji     bool              // leave :shortcode: emoji as text (--no-emoji)
+	noFootnotes bool              // leave [^1] footnotes as text (--no-footnotes)
+	localFiles  bool              // point relative href/src at /file/ (see --no-local-files)
+	includeMax  int               // nesting limit of <!-- include: --> directives; 0 = off
+	plantUMLURL string            // PlantUML server drawing ```plantuml``` fences (--plantuml-url)
+	plantUMLJar string            // plantuml.jar drawing them instead (--plantuml-jar)
+	maxSize     int64             // larger files aren't read (--max-size); 0 = no limit
+	checkLinks  bool              // mark relative links to missing files (--check-links)
+	cache       *renderCache      // --cache-dir; nil = always render
+	optionsHash string            // identifies the settings above, for cache entries
 }
 
-func NewRenderer() *Renderer {
-	md := goldmark.New(
-		goldmark.WithExtensions(
-			extension.GFM,
-			highlighting.NewHighlighting(
-				highlighting.WithStyle("github"),
-				highlighting.WithFormatOptions(),
-			),
-		),
-		goldmark.WithParserOptions(
-			parser.WithAutoHeadingID(),
-		),
-		goldmark.WithRendererOptions(
-			goldmarkhtml.WithHardWraps(),
-			goldmarkhtml.WithUnsafe(),
-			renderer.WithNodeRenderers(
-				// Priority lower than goldmark-highlighting (which uses 100) so we
-				// intercept "mermaid" fences before they hit chroma.
-				util.Prioritized(&mermaidRenderer{}, 99),
-			),
+// defaultHighlightTheme is the chroma style used unless
+// --highlight-theme-light says otherwise.
+const defaultHighlightTheme = "github"
+
+// RendererOption configures a Renderer at construction time.
+type RendererOption func(*Renderer)
+
+// WithLinkRewriteRules post-processes href/src attributes of rendered markdown
+// with the given rules (see --link-rewrite-rules).
+func WithLinkRewriteRules(rules []linkRewriteRule) RendererOption {
+	return func(r *Renderer) {
+		r.linkRules = rules
+	}
+}
+
+// WithLanguageMap aliases fence languages chroma doesn't know (e.g.
+// "shell-session" -> "bash"). Keys are matched case-insensitively.
+func WithLanguageMap(m map[string]string) RendererOption {
+	return func(r *Renderer) {
+		r.languageMap = make(map[string]string, len(m))
+		for src, dst := range m {
+			r.languageMap[strings.ToLower(src)] = dst
+		}
+	}
+}
+
+// WithSafeHTML drops raw HTML from markdown (see --no-unsafe). With
+// allowScript, <script> and <style> are still passed through.
+func WithSafeHTML(allowScript bool) RendererOption {
+	return func(r *Renderer) {
+		r.safeHTML = true
+		r.allowScript = allowScript
+	}
+}
+
+// WithTableClass sets the class attribute of every rendered markdown table
+// (see --table-class).
+func WithTableClass(class string) RendererOption {
+	return func(r *Renderer) {
+		r.tableClass = class
+	}
+}
+
+// WithTableWrapper wraps every rendered markdown table in a scrollable
+// <div class="table-wrapper"> (see --table-wrapper).
+func WithTableWrapper() RendererOption {
+	return func(r *Renderer) {
+		r.tableWrap = true
+	}
+}
+
+// WithDocCharset decodes text documents from the given charset before
+// rendering (see --doc-charset).
+func WithDocCharset(c *docCharset) RendererOption {
+	return func(r *Renderer) {
+		r.charset = c
+	}
+}
+
+// WithInlineHighlighting highlights inline code spans written as `lang:code`
+// (see --highlight-inline).
+func WithInlineHighlighting() RendererOption {
+	return func(r *Renderer) {
+		r.inlineCode = true
+	}
+}
+
+// WithGlobalHeader prepends the HTML template at path to every rendered
+// markdown file (see --global-header).
+func WithGlobalHeader(path string) RendererOption {
+	return func(r *Renderer) {
+		r.header = newHTMLFragment(path)
+	}
+}
+
+// WithGlobalFooter appends the HTML template at path to every rendered
+// markdown file (see --global-footer).
+func WithGlobalFooter(path string) RendererOption {
+	return func(r *Renderer) {
+		r.footer = newHTMLFragment(path)
+	}
+}
+
+// WithHighlightTheme sets the chroma style of inline-styled code
+// (see --highlight-theme-light).
+func WithHighlightTheme(name string) RendererOption {
+	return func(r *Renderer) {
+		r.theme = name
+	}
+}
+
+// WithHighlightClasses makes code highlighting emit chroma CSS classes, styled
+// by the /chroma.css and /chroma-dark.css stylesheets, instead of inline
+// styles of a single theme (see --highlight-theme-dark).
+func WithHighlightClasses() RendererOption {
+	return func(r *Renderer) {
+		r.classes = true
+	}
+}
+
+// WithASTDump writes the goldmark AST of every parsed markdown document to w
+// (see --print-ast).
+func WithASTDump(w io.Writer) RendererOption {
+	return func(r *Renderer) {
+		r.astOut = w
+	}
+}
+
+// WithLatexMathDelimiters lets markdown write math as \(…\) and \[…\]
+// (see convertLatexMath).
+func WithLatexMathDelimiters() RendererOption {
+	return func(r *Renderer) {
+		r.latexMath = true
+	}
+}
+
+// WithMath parses $…$ and $$…$$ math out of markdown into elements for
+// KaTeX (see --math and mathInline).
+func WithMath() RendererOption {
+	return func(r *Renderer) {
+		r.math = true
+	}
+}
+
+// WithTOC puts a table of contents of the headings down to level depth at
+// the top of rendered markdown (see --toc).
+func WithTOC(depth int) RendererOption {
+	return func(r *Renderer) {
+		r.tocDepth = depth
+	}
+}
+
+// WithHeadingIDPrefix prefixes each heading's id with a short hash of the
+// headings it is nested under, so repeated headings in different sections
+// don't collide (see --heading-id-prefix).
+func WithHeadingIDPrefix() RendererOption {
+	return func(r *Renderer) {
+		r.sectionIDs = true
+	}
+}
+
+// WithoutEmoji leaves emoji shortcodes like :smile: as text instead of
+// replacing them with the emoji (see --no-emoji).
+func WithoutEmoji() RendererOption {
+	return func(r *Renderer) {
+		r.noEmoji = true
+	}
+}
+
+// WithoutFootnotes leaves [^1] footnote references and definitions as text
+// (see --no-footnotes).
+func WithoutFootnotes() RendererOption {
+	return func(r *Renderer) {
+		r.noFootnotes = true
+	}
+}
+
+// WithLocalFileLinks rewrites relative href and src attributes of rendered
+// markdown to /file/ URLs of the files they name next to the document, for
+// a server that registers /file/ (see --no-local-files).
+func WithLocalFileLinks() RendererOption {
+	return func(r *Renderer) {
+		r.localFiles = true
+	}
+}
+
+// WithIncludeDepth limits how deeply <!-- include: file.md --> directives
+// nest (see --include-depth); 0 leaves them as comments.
+func WithIncludeDepth(depth int) RendererOption {
+	return func(r *Renderer) {
+		r.includeMax = depth
+	}
+}
+
+// WithPlantUML draws ```plantuml``` fences as SVG images with the PlantUML
+// server at serverURL or, if that is empty, by running the plantuml.jar at
+// jar.
+func WithPlantUML(serverURL, jar string) RendererOption {
+	return func(r *Renderer) {
+		r.plantUMLURL, r.plantUMLJar = serverURL, jar
+	}
+}
+
+// WithMaxFileSize refuses to render files larger than n bytes, which would
+// otherwise be read into memory whole (see --max-size).
+func WithMaxFileSize(n int64) RendererOption {
+	return func(r *Renderer) {
+		r.maxSize = n
+	}
+}
+
+// WithLinkCheck marks relative links in rendered markdown whose files don't
+// exist and lists them in RenderResult.BrokenLinks (see --check-links).
+func WithLinkCheck() RendererOption {
+	return func(r *Renderer) {
+		r.checkLinks = true
+	}
+}
+
+// WithRenderCache keeps rendered markdown in dir, evicting the oldest
+// entries beyond maxSize bytes (0 = unlimited).
+func WithRenderCache(dir string, maxSize int64) RendererOption {
+	return func(r *Renderer) {
+		r.cache = openRenderCache(dir, maxSize)
+	}
+}
+
+func NewRenderer(opts ...RendererOption) *Renderer {
+	r := &Renderer{theme: defaultHighlightTheme, includeMax: defaultIncludeDepth, maxSize: defaultMaxFileSize}
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	codeBlocks := newCodeBlockRenderer(r.languageMap,
+		highlighting.WithStyle(r.theme),
+		highlighting.WithFormatOptions(
+			html.WithClasses(r.classes),
+			html.WithCustomCSS(themeCustomCSS(r.theme)),
 		),
 	)
+	if r.plantUMLURL != "" || r.plantUMLJar != "" {
+		codeBlocks.plantUML = newPlantUML(r.plantUMLURL, r.plantUMLJar)
+	}
+	nodeRenderers := []util.PrioritizedValue{
+		// Higher priority than goldmark's default code block renderer;
+		// chroma highlighting happens inside via the wrapped renderer.
+		util.Prioritized(codeBlocks, 99),
+	}
+	if r.tableClass != "" || r.tableWrap {
+		// Higher priority than the GFM table renderer (500), which it wraps.
+		nodeRenderers = append(nodeRenderers, util.Prioritized(newTableRenderer(r.tableClass, r.tableWrap), 99))
+	}
+	if r.inlineCode {
+		nodeRenderers = append(nodeRenderers, util.Prioritized(&inlineCodeRenderer{
+			languageMap: r.languageMap,
+			theme:       r.theme,
+			classes:     r.classes,
+		}, 99))
+	}
+	rendererOpts := []renderer.Option{
+		goldmarkhtml.WithHardWraps(),
+	}
+	if !r.safeHTML {
+		rendererOpts = append(rendererOpts, goldmarkhtml.WithUnsafe())
+	} else if r.allowScript {
+		nodeRenderers = append(nodeRenderers, util.Prioritized(&scriptPassthroughRenderer{}, 99))
+	}
+	if r.tocDepth > 0 {
+		nodeRenderers = append(nodeRenderers, util.Prioritized(&tocRenderer{}, 99))
+	}
+	if r.math {
+		nodeRenderers = append(nodeRenderers, util.Prioritized(&mathRenderer{}, 99))
+	}
+	rendererOpts = append(rendererOpts, renderer.WithNodeRenderers(nodeRenderers...))
+
+	parserOpts := []parser.Option{
+		parser.WithAutoHeadingID(),
+	}
+	if r.math {
+		// Ahead of code spans (100) and fenced code (700); '$' triggers nothing else.
+		parserOpts = append(parserOpts,
+			parser.WithInlineParsers(util.Prioritized(&mathInlineParser{}, 90)),
+			parser.WithBlockParsers(util.Prioritized(&mathBlockParser{}, 690)),
+		)
+	}
+	if r.sectionIDs {
+		// Ahead of the TOC, which links to the ids.
+		parserOpts = append(parserOpts, parser.WithASTTransformers(util.Prioritized(&sectionIDTransformer{}, 900)))
+	}
+	if r.tocDepth > 0 {
+		parserOpts = append(parserOpts, parser.WithASTTransformers(util.Prioritized(&tocTransformer{depth: r.tocDepth}, 1000)))
+	}
+	if r.astOut != nil {
+		// Runs after every other transformer, so it shows the final tree.
+		parserOpts = append(parserOpts, parser.WithASTTransformers(util.Prioritized(&astPrinter{w: r.astOut}, 10000)))
+	}
+
+	extensions := []goldmark.Extender{extension.GFM}
+	if !r.noEmoji {
+		extensions = append(extensions, &emojiExtension{})
+	}
+	if !r.noFootnotes {
+		// Footnote ids (fn:1, fnref:1) keep their colon, which heading ids
+		// from WithAutoHeadingID never have, so the two can't collide.
+		extensions = append(extensions, extension.Footnote)
+	}
+	r.md = goldmark.New(
+		goldmark.WithExtensions(extensions...),
+		goldmark.WithParserOptions(parserOpts...),
+		goldmark.WithRendererOptions(rendererOpts...),
+	)
 
-	return &Renderer{md: md}
+	if r.cache != nil {
+		r.optionsHash = r.settingsHash()
+	}
+	return r
 }
 
-// mermaidRenderer turns ```mermaid``` fenced code blocks into divs that
-// client-side mermaid.js can pick up. Other languages fall through to the
-// default highlighting renderer.
-type mermaidRenderer struct{}
+// settingsHash summarizes everything that changes rendered markdown, so
+// cache entries from another configuration (or livemd version) are missed.
+func (r *Renderer) settingsHash() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s|%v|%v|%q|%v|%v|%q|%v|%v|%v|%d|%v|%v|%v|%v|%q|%q", Version, r.languageMap, r.safeHTML,
+		r.tableClass, r.tableWrap, r.inlineCode, r.theme, r.classes, r.allowScript, r.latexMath, r.tocDepth, r.math, r.noEmoji, r.noFootnotes,
+		r.sectionIDs, r.plantUMLURL, r.plantUMLJar)
+	for _, rule := range r.linkRules {
+		fmt.Fprintf(&b, "|%s=>%s", rule.pattern, rule.replacement)
+	}
+	return contentHash([]byte(b.String()))
+}
 
-func (r *mermaidRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+// codeBlockRenderer owns fenced code blocks. ```mermaid``` fences become divs
+// that client-side mermaid.js can pick up, ```plantuml``` fences images drawn
+// by plantUML; everything else goes to the goldmark-highlighting renderer it
+// wraps, after language aliasing.
+//
+// goldmark keeps only one renderer func per node kind, so wrapping (rather
+// than registering alongside highlighting) is what lets non-mermaid fences
+// still reach chroma.
+type codeBlockRenderer struct {
+	highlighter renderer.NodeRenderer
+	highlight   renderer.NodeRendererFunc
+	languageMap map[string]string
+	plantUML    *plantUML // nil = show PlantUML fences as code
+}
+
+func newCodeBlockRenderer(languageMap map[string]string, opts ...highlighting.Option) *codeBlockRenderer {
+	r := &codeBlockRenderer{
+		highlighter: highlighting.NewHTMLRenderer(opts...),
+		languageMap: languageMap,
+	}
+	r.highlighter.RegisterFuncs(funcCapture(func(kind ast.NodeKind, fn renderer.NodeRendererFunc) {
+		if kind == ast.KindFencedCodeBlock {
+			r.highlight = fn
+		}
+	}))
+	return r
+}
+
+// funcCapture adapts a function to NodeRendererFuncRegisterer so a wrapped
+// NodeRenderer's funcs can be collected instead of registered with goldmark.
+type funcCapture func(kind ast.NodeKind, fn renderer.NodeRendererFunc)
+
+func (f funcCapture) Register(kind ast.NodeKind, fn renderer.NodeRendererFunc) {
+	f(kind, fn)
+}
+
+func (r *codeBlockRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
 	reg.Register(ast.KindFencedCodeBlock, r.render)
 }
 
-func (r *mermaidRenderer) render(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+// SetOption forwards goldmark renderer options (XHTML, unsafe, ...) to the
+// wrapped highlighter, which goldmark no longer sees directly.
+func (r *codeBlockRenderer) SetOption(name renderer.OptionName, value interface{}) {
+	if so, ok := r.highlighter.(renderer.SetOptioner); ok {
+		so.SetOption(name, value)
+	}
+}
+
+func (r *codeBlockRenderer) render(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
 	n := node.(*ast.FencedCodeBlock)
-	if string(n.Language(source)) != "mermaid" {
-		return ast.WalkContinue, nil
+	lang := string(n.Language(source))
+	if isPlantUML(lang) {
+		if r.plantUML != nil {
+			if entering {
+				var diagram []byte
+				for i := 0; i < n.Lines().Len(); i++ {
+					line := n.Lines().At(i)
+					diagram = append(diagram, line.Value(source)...)
+				}
+				markup, final := r.plantUML.render(diagram)
+				if !final {
+					n.OwnerDocument().SetAttributeString(uncacheableAttr, true)
+				}
+				w.WriteString(markup)
+			}
+			return ast.WalkSkipChildren, nil
+		}
+		if entering {
+			w.WriteString(plantUMLMissing)
+		}
+	}
+	if lang != "mermaid" {
+		if entering {
+			setLenientAttributes(n, source)
+		}
+		if dst, ok := r.languageMap[strings.ToLower(lang)]; ok {
+			n, source = withLanguage(n, source, dst)
+		}
+		return r.highlight(w, source, n, entering)
 	}
 	if !entering {
 		return ast.WalkContinue, nil
@@ -85,46 +469,428 @@ func (r *mermaidRenderer) render(w util.BufWriter, source []byte, node ast.Node,
 	return ast.WalkSkipChildren, nil
 }
 
-func (r *Renderer) Render(path string) (string, error) {
+// tableRenderer wraps goldmark's GFM table renderer to add a class to every
+// <table> and optionally surround it with a wrapper div.
+type tableRenderer struct {
+	inner renderer.NodeRenderer
+	table renderer.NodeRendererFunc
+	class string
+	wrap  bool
+}
+
+func newTableRenderer(class string, wrap bool) *tableRenderer {
+	r := &tableRenderer{
+		inner: extension.NewTableHTMLRenderer(),
+		class: class,
+		wrap:  wrap,
+	}
+	r.inner.RegisterFuncs(funcCapture(func(kind ast.NodeKind, fn renderer.NodeRendererFunc) {
+		if kind == east.KindTable {
+			r.table = fn
+		}
+	}))
+	return r
+}
+
+func (r *tableRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(east.KindTable, r.render)
+}
+
+func (r *tableRenderer) SetOption(name renderer.OptionName, value interface{}) {
+	if so, ok := r.inner.(renderer.SetOptioner); ok {
+		so.SetOption(name, value)
+	}
+}
+
+func (r *tableRenderer) render(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if entering {
+		if r.wrap {
+			w.WriteString(`<div class="table-wrapper">` + "\n")
+		}
+		if r.class != "" {
+			node.SetAttributeString("class", []byte(r.class))
+		}
+		return r.table(w, source, node, entering)
+	}
+	status, err := r.table(w, source, node, entering)
+	if r.wrap {
+		w.WriteString("</div>\n")
+	}
+	return status, err
+}
+
+// inlineLangPattern matches the `lang:code` hint of --highlight-inline.
+var inlineLangPattern = regexp.MustCompile(`^([A-Za-z0-9_+#.-]+):(.+)$`)
+
+// inlineCodeRenderer highlights inline code spans that start with a language
+// chroma knows, e.g. `go:x := 1`. Other spans render as plain <code>, the
+// same as goldmark's default.
+type inlineCodeRenderer struct {
+	languageMap map[string]string
+	theme       string
+	classes     bool
+}
+
+func (r *inlineCodeRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(ast.KindCodeSpan, r.render)
+}
+
+func (r *inlineCodeRenderer) render(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	var code []byte
+	for c := node.FirstChild(); c != nil; c = c.NextSibling() {
+		value := c.(*ast.Text).Segment.Value(source)
+		if bytes.HasSuffix(value, []byte("\n")) {
+			value = append(value[:len(value)-1:len(value)-1], ' ')
+		}
+		code = append(code, value...)
+	}
+
+	// "http://..." would otherwise pick the HTTP lexer; URLs stay plain.
+	if m := inlineLangPattern.FindSubmatch(code); m != nil && !bytes.HasPrefix(m[2], []byte("//")) {
+		lang := string(m[1])
+		if dst, ok := r.languageMap[strings.ToLower(lang)]; ok {
+			lang = dst
+		}
+		if lexer := lexers.Get(lang); lexer != nil {
+			if iterator, err := chroma.Coalesce(lexer).Tokenise(nil, string(m[2])); err == nil {
+				formatter := html.New(html.WithClasses(r.classes), html.PreventSurroundingPre(true))
+				var buf bytes.Buffer
+				if formatter.Format(&buf, styles.Get(r.theme), iterator) == nil {
+					if r.classes {
+						// Chroma's class rules are scoped to .chroma.
+						w.WriteString(`<code class="inline-code chroma">`)
+					} else {
+						w.WriteString(`<code class="inline-code">`)
+					}
+					w.Write(bytes.TrimSuffix(buf.Bytes(), []byte("\n")))
+					w.WriteString("</code>")
+					return ast.WalkSkipChildren, nil
+				}
+			}
+		}
+	}
+
+	w.WriteString("<code>")
+	w.Write(util.EscapeHTML(code))
+	w.WriteString("</code>")
+	return ast.WalkSkipChildren, nil
+}
+
+// bareRangePattern matches an unquoted line range such as 3-5 inside an
+// attribute list; goldmark's attribute parser only accepts "3-5".
+var bareRangePattern = regexp.MustCompile(`([\[,]\s*)(\d+\s*-\s*\d+)(\s*[\],])`)
+
+// hlLinesValuePattern matches an hl_lines value that isn't a list: a single
+// line or range, bare or quoted, or a quoted "1 3-5" or "1,3-5".
+var hlLinesValuePattern = regexp.MustCompile(`(\bhl_lines\s*=\s*)(?:"([\d\s,-]*)"|(\d+(?:\s*-\s*\d+)?))`)
+
+// rangeDashPattern matches the dash of a line range with any spaces around it.
+var rangeDashPattern = regexp.MustCompile(`\s*-\s*`)
+
+// hlLinesList rewrites the hl_lines value m matched as a list of quoted
+// lines and ranges, e.g. ["1","3-5"].
+func hlLinesList(m []byte) []byte {
+	sub := hlLinesValuePattern.FindSubmatch(m)
+	value := sub[2]
+	if sub[3] != nil {
+		value = sub[3]
+	}
+	value = rangeDashPattern.ReplaceAll(value, []byte("-"))
+	var items [][]byte
+	for _, item := range bytes.FieldsFunc(value, func(r rune) bool { return r == ' ' || r == ',' }) {
+		items = append(items, []byte(`"`+string(item)+`"`))
+	}
+	out := append([]byte(nil), sub[1]...)
+	out = append(out, '[')
+	out = append(out, bytes.Join(items, []byte(","))...)
+	return append(out, ']')
+}
+
+// setLenientAttributes parses the {...} of a fence info string such as
+// "go {hl_lines=[1,3-5]}" into node attributes, quoting bare ranges first.
+// A value that isn't a list, as in hl_lines=3, hl_lines=2-4 or
+// hl_lines="1 3-5", becomes one. goldmark-highlighting prefers node
+// attributes over its own parse of the info string, which would drop the
+// whole list at the first bare range and only accepts lists.
+func setLenientAttributes(n *ast.FencedCodeBlock, source []byte) {
+	if n.Info == nil || n.Attributes() != nil {
+		return
+	}
+	info := n.Info.Segment.Value(source)
+	start := bytes.IndexByte(info, '{')
+	if start < 0 {
+		return
+	}
+	attrs := info[start:]
+	quoted := hlLinesValuePattern.ReplaceAllFunc(attrs, hlLinesList)
+	for {
+		// Loop because adjacent ranges share the comma between them.
+		next := bareRangePattern.ReplaceAllFunc(quoted, func(m []byte) []byte {
+			sub := bareRangePattern.FindSubmatch(m)
+			var out []byte
+			out = append(out, sub[1]...)
+			out = append(out, '"')
+			out = append(out, bytes.ReplaceAll(sub[2], []byte(" "), nil)...)
+			out = append(out, '"')
+			return append(out, sub[3]...)
+		})
+		if bytes.Equal(next, quoted) {
+			break
+		}
+		quoted = next
+	}
+	if bytes.Equal(quoted, attrs) {
+		return // nothing goldmark-highlighting can't parse itself
+	}
+	parsed, ok := parser.ParseAttributes(text.NewReader(quoted))
+	if !ok {
+		return
+	}
+	for _, attr := range parsed {
+		n.SetAttribute(attr.Name, attr.Value)
+	}
+}
+
+// withLanguage returns a detached copy of n whose info string starts with lang
+// instead of the original language, plus the small source buffer its segments
+// point into. The rest of the info string (e.g. {hl_lines=...}) and any node
+// attributes are carried over.
+func withLanguage(n *ast.FencedCodeBlock, source []byte, lang string) (*ast.FencedCodeBlock, []byte) {
+	info := n.Info.Segment.Value(source)
+	rest := info[len(n.Language(source)):]
+
+	var buf bytes.Buffer
+	buf.WriteString(lang)
+	buf.Write(rest)
+	infoSeg := text.NewSegment(0, buf.Len())
+
+	lines := text.NewSegments()
+	for i := 0; i < n.Lines().Len(); i++ {
+		line := n.Lines().At(i)
+		start := buf.Len()
+		buf.Write(line.Value(source))
+		lines.Append(text.NewSegment(start, buf.Len()))
+	}
+
+	clone := ast.NewFencedCodeBlock(ast.NewTextSegment(infoSeg))
+	clone.SetLines(lines)
+	for _, attr := range n.Attributes() {
+		clone.SetAttribute(attr.Name, attr.Value)
+	}
+	return clone, buf.Bytes()
+}
+
+// RenderResult is a rendered file.
+type RenderResult struct {
+	HTML      string
+	Meta      map[string]interface{} // YAML front matter of markdown; nil if there is none
+	MetaError error                  // why the front matter didn't parse; HTML still has the body
+	Includes  []string               // files pulled in by <!-- include: --> directives, sorted
+	Elapsed   time.Duration          // how long rendering took
+
+	BrokenLinks []string // relative links to missing files, with --check-links
+	LocalFiles  []string // files the HTML links to at /file/
+}
+
+// Render renders the file at path, timing it for RenderResult.Elapsed and
+// the livemd_render_duration_seconds metric.
+func (r *Renderer) Render(path string) (RenderResult, error) {
+	start := time.Now()
+	res, err := r.render(path)
+	res.Elapsed = time.Since(start)
+	renderDuration.Observe(res.Elapsed.Seconds())
+	return res, err
+}
+
+func (r *Renderer) render(path string) (RenderResult, error) {
 	ext := strings.ToLower(filepath.Ext(path))
 
 	// Media: rendered as <img>/<embed>/<audio>/<video> referencing /raw.
 	// Don't read content into memory — the browser fetches via /raw.
 	if html, ok := renderMedia(path, ext); ok {
-		return html, nil
+		return RenderResult{HTML: html}, nil
 	}
 
 	// Tabular: read and render as HTML table.
 	if ext == ".csv" || ext == ".tsv" {
-		content, err := os.ReadFile(path)
+		content, err := r.readText(path)
 		if err != nil {
-			return "", err
+			return RenderResult{}, err
 		}
-		return renderTable(content, ext == ".tsv"), nil
+		return RenderResult{HTML: renderTable(content, ext == ".tsv")}, nil
 	}
 
-	content, err := os.ReadFile(path)
+	content, err := r.readText(path)
 	if err != nil {
-		return "", err
+		return RenderResult{}, err
 	}
 
 	if isBinary(content) {
-		return renderBinaryMessage(path), nil
+		return RenderResult{HTML: renderBinaryMessage(path)}, nil
 	}
 
 	if isMarkdown(path) {
-		return r.renderMarkdown(content)
+		return r.renderMarkdownFile(path, content)
 	}
 
-	return r.renderCode(path, content)
+	html, err := r.renderCode(path, content)
+	if err != nil {
+		return RenderResult{}, err
+	}
+	return RenderResult{HTML: html}, nil
+}
+
+// renderMarkdownFile renders a markdown document without its leading YAML
+// front matter, which is parsed into Meta instead. A block missing its
+// closing "---" isn't front matter and renders as markdown.
+func (r *Renderer) renderMarkdownFile(path string, content []byte) (RenderResult, error) {
+	var res RenderResult
+	front, body := splitFrontMatter(content)
+	if front != nil {
+		res.Meta = make(map[string]interface{})
+		if err := yaml.Unmarshal(front, &res.Meta); err != nil {
+			res.Meta, res.MetaError = nil, fmt.Errorf("front matter: %w", err)
+		}
+	}
+	// Before the cache, so its key covers the included content.
+	body, res.Includes = expandIncludes(path, body, r.includeMax, r.readText)
+	html, err := r.renderMarkdownCached(path, body)
+	if err != nil {
+		return RenderResult{}, err
+	}
+	if r.checkLinks {
+		// After the cache, as files come and go, and before the links are
+		// no longer relative.
+		html, res.BrokenLinks = checkLinks(html, filepath.Dir(path))
+	}
+	if r.localFiles {
+		// After the cache, whose entries are shared by identical documents
+		// in different directories.
+		html, res.LocalFiles = localFileLinks(html, filepath.Dir(path))
+	}
+	if res.HTML, err = r.addFragments(path, body, html); err != nil {
+		return RenderResult{}, err
+	}
+	return res, nil
+}
+
+// Includes returns the files the markdown file at path pulls in with
+// <!-- include: --> directives, transitively, for watching them.
+func (r *Renderer) Includes(path string) []string {
+	if !isMarkdown(path) {
+		return nil
+	}
+	content, err := r.readText(path)
+	if err != nil {
+		return nil
+	}
+	_, body := splitFrontMatter(content)
+	_, includes := expandIncludes(path, body, r.includeMax, r.readText)
+	return includes
+}
+
+// addFragments surrounds rendered markdown with the global header/footer.
+func (r *Renderer) addFragments(path string, content []byte, html string) (string, error) {
+	if r.header == nil && r.footer == nil {
+		return html, nil
+	}
+	data := fragmentData{
+		Filename:  filepath.Base(path),
+		Title:     firstH1Text(html),
+		WordCount: len(strings.Fields(string(content))),
+	}
+	if data.Title == "" {
+		data.Title = data.Filename
+	}
+	if info, err := os.Stat(path); err == nil {
+		data.Date = info.ModTime().Format("2006-01-02")
+	}
+
+	if r.header != nil {
+		header, err := r.header.render(data)
+		if err != nil {
+			return "", fmt.Errorf("global header: %w", err)
+		}
+		html = header + html
+	}
+	if r.footer != nil {
+		footer, err := r.footer.render(data)
+		if err != nil {
+			return "", fmt.Errorf("global footer: %w", err)
+		}
+		html += footer
+	}
+	return html, nil
+}
+
+// readText reads a text document and converts it to UTF-8 per --doc-charset.
+// Files over --max-size aren't read.
+func (r *Renderer) readText(path string) ([]byte, error) {
+	if r.maxSize > 0 {
+		if info, err := os.Stat(path); err == nil && info.Size() > r.maxSize {
+			return nil, fmt.Errorf("%s is %s, over the %s limit of --max-size",
+				filepath.Base(path), formatBytes(info.Size()), formatBytes(r.maxSize))
+		}
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if r.charset == nil {
+		return content, nil
+	}
+	decoded, err := r.charset.decode(content)
+	if err != nil {
+		return nil, fmt.Errorf("decoding %s: %w", filepath.Base(path), err)
+	}
+	return decoded, nil
 }
 
 func (r *Renderer) renderMarkdown(content []byte) (string, error) {
+	html, _, err := r.convertMarkdown(content)
+	return html, err
+}
+
+// uncacheableAttr is set on a document by a node renderer whose output may
+// differ next time, e.g. a PlantUML diagram drawn while its server was down.
+const uncacheableAttr = "livemd-uncacheable"
+
+// convertMarkdown renders content and reports whether the result may be
+// kept in the --cache-dir cache.
+func (r *Renderer) convertMarkdown(content []byte) (string, bool, error) {
+	if r.latexMath {
+		content = convertLatexMath(content)
+	}
+	doc := r.md.Parser().Parse(text.NewReader(content))
 	var buf bytes.Buffer
-	if err := r.md.Convert(content, &buf); err != nil {
+	if err := r.md.Renderer().Render(&buf, content, doc); err != nil {
+		return "", false, err
+	}
+	_, uncacheable := doc.AttributeString(uncacheableAttr)
+	return rewriteLinks(buf.String(), r.linkRules), !uncacheable, nil
+}
+
+// renderMarkdownCached is renderMarkdown through the --cache-dir cache.
+// --print-ast bypasses it so every render is dumped.
+func (r *Renderer) renderMarkdownCached(path string, content []byte) (string, error) {
+	if r.cache == nil || r.astOut != nil {
+		return r.renderMarkdown(content)
+	}
+	hash := contentHash(content)
+	if html, ok := r.cache.Get(hash, r.optionsHash); ok {
+		return html, nil
+	}
+	html, cacheable, err := r.convertMarkdown(content)
+	if err != nil {
 		return "", err
 	}
-	return buf.String(), nil
+	if cacheable {
+		r.cache.Put(hash, r.optionsHash, path, html)
+	}
+	return html, nil
 }
 
 func (r *Renderer) renderCode(path string, content []byte) (string, error) {
@@ -145,12 +911,12 @@ func (r *Renderer) renderCode(path string, content []byte) (string, error) {
 	lexer = chroma.Coalesce(lexer)
 
 	// Get style and formatter
-	style := styles.Get("github")
+	style := styles.Get(r.theme)
 	if style == nil {
 		style = styles.Fallback
 	}
 	formatter := html.New(
-		html.WithClasses(false),
+		html.WithClasses(r.classes),
 		html.WithLineNumbers(true),
 		html.TabWidth(4),
 	)
@@ -289,6 +1055,15 @@ func renderTable(content []byte, tsv bool) string {
 	return b.String()
 }
 
+// renderErrorMessage is shown instead of a file that couldn't be rendered,
+// such as one over --max-size.
+func renderErrorMessage(err error) string {
+	return `<div style="text-align: center; padding: 40px; color: #666;">
+		<p style="font-size: 48px; margin-bottom: 16px;">⚠️</p>
+		<p>` + template.HTMLEscapeString(err.Error()) + `</p>
+	</div>`
+}
+
 func renderBinaryMessage(path string) string {
 	ext := strings.ToLower(filepath.Ext(path))
 	name := filepath.Base(path)
@@ -452,3 +1227,60 @@ func getLexer(path string) chroma.Lexer {
 	// Fallback
 	return lexers.Fallback
 }
+
+// themeCustomCSS returns chroma CSS overrides for a style, or nil.
+func themeCustomCSS(theme string) map[chroma.TokenType]string {
+	if theme == defaultHighlightTheme {
+		// github's own line highlight (#e5e5e5) barely shows on white.
+		return map[chroma.TokenType]string{
+			chroma.LineHighlight: "background-color: #fff8c5",
+		}
+	}
+	return nil
+}
+
+// isHighlightTheme reports whether chroma has a style called name.
+func isHighlightTheme(name string) bool {
+	_, ok := styles.Registry[name]
+	return ok
+}
+
+// highlightThemes lists the chroma style names, sorted.
+func highlightThemes() []string {
+	return styles.Names()
+}
+
+// highlightStylesheet returns the CSS for class-based highlighting output
+// (WithHighlightClasses) in the given chroma style.
+func highlightStylesheet(theme string) []byte {
+	var buf bytes.Buffer
+	formatter := html.New(html.WithClasses(true), html.WithCustomCSS(themeCustomCSS(theme)))
+	formatter.WriteCSS(&buf, styles.Get(theme))
+	return buf.Bytes()
+}
+
+// firstH1Text returns the text content of the first <h1> in rendered HTML,
+// with nested tags stripped and whitespace collapsed, or "" if there is none.
+func firstH1Text(rendered string) string {
+	z := xhtml.NewTokenizer(strings.NewReader(rendered))
+	depth := 0 // >0 while inside the first <h1>
+	var text strings.Builder
+	for {
+		switch z.Next() {
+		case xhtml.ErrorToken:
+			return strings.Join(strings.Fields(text.String()), " ")
+		case xhtml.StartTagToken:
+			if name, _ := z.TagName(); string(name) == "h1" {
+				depth++
+			}
+		case xhtml.EndTagToken:
+			if name, _ := z.TagName(); string(name) == "h1" && depth > 0 {
+				return strings.Join(strings.Fields(text.String()), " ")
+			}
+		case xhtml.TextToken:
+			if depth > 0 {
+				text.Write(z.Text())
+			}
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"html"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// highlightedLines returns the numbers of the lines of the first code block
+// in html that have chroma's line highlight.
+func highlightedLines(html string) []int {
+	var lines []int
+	for i, line := range strings.Split(html, `<span style="display:flex;`)[1:] {
+		if strings.HasPrefix(line, " background-color:") {
+			lines = append(lines, i+1)
+		}
+	}
+	return lines
+}
+
+func TestLineHighlighting(t *testing.T) {
+	r := NewRenderer()
+	tests := []struct {
+		attrs string
+		want  []int
+	}{
+		{"", nil},
+		{"{hl_lines=[2]}", []int{2}},
+		{"{hl_lines=3}", []int{3}},
+		{"{hl_lines=2-4}", []int{2, 3, 4}},
+		{`{hl_lines="2-4"}`, []int{2, 3, 4}},
+		{`{hl_lines="1 3-5"}`, []int{1, 3, 4, 5}},
+		{`{hl_lines="1,3-5"}`, []int{1, 3, 4, 5}},
+		{"{hl_lines=[1,3-5]}", []int{1, 3, 4, 5}},
+		{"{hl_lines=[1, 3 - 4]}", []int{1, 3, 4}},
+		{`{hl_lines=["1","3-4"]}`, []int{1, 3, 4}},
+		{"{hl_lines=[2-3,5]}", []int{2, 3, 5}},
+	}
+	for _, tt := range tests {
+		html, err := r.renderMarkdown([]byte("```go " + tt.attrs + "\na\nb\nc\nd\ne\n```\n"))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.attrs, err)
+		}
+		if got := highlightedLines(html); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q highlights lines %v, want %v", tt.attrs, got, tt.want)
+		}
+	}
+}
+
+func TestInlineCodeHighlighting(t *testing.T) {
+	r := NewRenderer(WithInlineHighlighting())
+	html, err := r.renderMarkdown([]byte("`go:fmt.Println(\"hi\")`"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(html, `<p><code class="inline-code">`) || !strings.Contains(html, `<span style="`) {
+		t.Errorf("go:fmt.Println(\"hi\") renders as %q, want chroma spans in <code class=\"inline-code\">", html)
+	}
+	if strings.Contains(html, "<pre") || strings.Contains(html, "go:") {
+		t.Errorf("highlighted inline code %q has a <pre> or its language hint", html)
+	}
+
+	for _, in := range []string{"plain", "nosuchlang:x", "http://example.com"} {
+		html, err := r.renderMarkdown([]byte("`" + in + "`"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := "<p><code>" + in + "</code></p>\n"; html != want {
+			t.Errorf("`%s` renders as %q, want %q", in, html, want)
+		}
+	}
+}
+
+func TestHighlightThemes(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"github", true},
+		{"monokai", true},
+		{"dracula", true},
+		{"solarized-dark", true},
+		{"no-such-theme", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := isHighlightTheme(tt.name); got != tt.want {
+			t.Errorf("isHighlightTheme(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+		if !tt.want {
+			continue
+		}
+		if r := NewRenderer(WithHighlightTheme(tt.name)); r.theme != tt.name {
+			t.Errorf("WithHighlightTheme(%q) sets theme %q", tt.name, r.theme)
+		}
+	}
+	if names := highlightThemes(); len(names) == 0 || names[0] > names[len(names)-1] {
+		t.Errorf("highlightThemes() = %v, want the sorted style names", names)
+	}
+}
+
+func TestMermaidBlockKeepsSource(t *testing.T) {
+	r := NewRenderer()
+	tests := []struct {
+		name, source string
+	}{
+		{"plain", "graph TD\n  A[Start] --- B(Stop)\n"},
+		// Only what would break the markup is escaped; mermaid.js reads the
+		// text back as written.
+		{"arrows and ampersands", "graph LR\n  A-->B & C\n  B -.-> |\"x < y\"| D\n"},
+	}
+	for _, tt := range tests {
+		out, err := r.renderMarkdown([]byte("```mermaid\n" + tt.source + "```\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		inner, ok := strings.CutPrefix(out, `<div class="mermaid">`)
+		inner, ok2 := strings.CutSuffix(inner, "</div>")
+		if !ok || !ok2 {
+			t.Fatalf("%s: renders as %q, want a single <div class=\"mermaid\">", tt.name, out)
+		}
+		if strings.Contains(inner, "<") {
+			t.Errorf("%s: diagram source is highlighted or wrapped: %q", tt.name, inner)
+		}
+		if got := html.UnescapeString(inner); got != tt.source {
+			t.Errorf("%s: diagram source = %q, want %q verbatim", tt.name, got, tt.source)
+		}
+		if !strings.ContainsAny(tt.source, "<>&\"") && inner != tt.source {
+			t.Errorf("%s: source without markup characters was changed: %q", tt.name, inner)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"regexp"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/util"
+)
+
+// scriptTagPattern matches raw HTML that opens or closes a <script> or
+// <style> element.
+var scriptTagPattern = regexp.MustCompile(`(?i)^\s*</?(?:script|style)(?:[\s/>]|$)`)
+
+// rawHTMLOmitted is what goldmark writes in place of raw HTML when unsafe
+// rendering is off; other tags keep producing it.
+const rawHTMLOmitted = "<!-- raw HTML omitted -->"
+
+// scriptPassthroughRenderer is used with --no-unsafe --unsafe-allow-script.
+// It takes over raw HTML rendering from goldmark so <script> and <style>
+// blocks and tags are written verbatim while every other piece of raw HTML is
+// still omitted, exactly as goldmark would without WithUnsafe.
+type scriptPassthroughRenderer struct{}
+
+func (r *scriptPassthroughRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(ast.KindHTMLBlock, r.renderHTMLBlock)
+	reg.Register(ast.KindRawHTML, r.renderRawHTML)
+}
+
+func (r *scriptPassthroughRenderer) renderHTMLBlock(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	n := node.(*ast.HTMLBlock)
+	// <script> and <style> only ever start a type 1 block, which runs until
+	// the matching close tag, so the first line decides for the whole block.
+	allowed := false
+	if n.HTMLBlockType == ast.HTMLBlockType1 && n.Lines().Len() > 0 {
+		first := n.Lines().At(0)
+		allowed = scriptTagPattern.Match(first.Value(source))
+	}
+	if entering {
+		if !allowed {
+			w.WriteString(rawHTMLOmitted + "\n")
+			return ast.WalkContinue, nil
+		}
+		for i := 0; i < n.Lines().Len(); i++ {
+			line := n.Lines().At(i)
+			w.Write(line.Value(source))
+		}
+	} else if n.HasClosure() {
+		if !allowed {
+			w.WriteString(rawHTMLOmitted + "\n")
+			return ast.WalkContinue, nil
+		}
+		w.Write(n.ClosureLine.Value(source))
+	}
+	return ast.WalkContinue, nil
+}
+
+func (r *scriptPassthroughRenderer) renderRawHTML(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkSkipChildren, nil
+	}
+	n := node.(*ast.RawHTML)
+	var raw []byte
+	for i := 0; i < n.Segments.Len(); i++ {
+		segment := n.Segments.At(i)
+		raw = append(raw, segment.Value(source)...)
+	}
+	if scriptTagPattern.Match(raw) {
+		w.Write(raw)
+	} else {
+		w.WriteString(rawHTMLOmitted)
+	}
+	return ast.WalkSkipChildren, nil
+}
@@ -2,21 +2,34 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
+	"crypto/tls"
 	"embed"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"html"
+	"html/template"
+	"io"
 	"io/fs"
-	"log"
+	"log/slog"
+	"mime"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	"github.com/fsnotify/fsnotify"
 	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 //go:embed static
@@ -24,91 +37,285 @@ var staticFiles embed.FS
 
 // WatchedFile represents a file being watched
 type WatchedFile struct {
-	Path       string    `json:"path"`
-	Name       string    `json:"name"`
-	TrackTime  time.Time `json:"trackTime"`
-	LastChange time.Time `json:"lastChange"`
-	HTML       string    `json:"html,omitempty"`
-	Active     bool      `json:"active"`  // true if actively being watched by fsnotify
-	Deleted    bool      `json:"deleted"` // true if file was deleted from disk
+	Path        string    `json:"path"`
+	Name        string    `json:"name"`
+	TrackTime   time.Time `json:"trackTime"`
+	LastChange  time.Time `json:"lastChange"`
+	HTML        string    `json:"html,omitempty"`
+	Title       string    `json:"title,omitempty"`       // page title from the first <h1> (--title-from-h1)
+	BrokenLinks []string  `json:"brokenLinks,omitempty"` // relative links to missing files (--check-links)
+	Active      bool      `json:"active"`                // true if actively being watched by fsnotify
+	Deleted     bool      `json:"deleted"`               // true if file was deleted from disk
+	LocalFiles  []string  `json:"-"`                     // files its HTML links to, which /file/ serves
+	Warning     string    `json:"warning,omitempty"`     // why it is over --word-count-threshold
+
+	hash string // Message.Hash of HTML, set by sameAsBroadcast
 }
 
 // Message sent to clients via WebSocket
 type Message struct {
-	Type    string          `json:"type"`
-	Files   []WatchedFile   `json:"files,omitempty"`
-	Folders []WatchedFolder `json:"folders,omitempty"`
-	File    *WatchedFile    `json:"file,omitempty"`
-	Path    string          `json:"path,omitempty"`
-	Log     *LogEntry       `json:"log,omitempty"`
-	Logs    []LogEntry      `json:"logs,omitempty"`
+	Type     string          `json:"type"`
+	Files    []WatchedFile   `json:"files,omitempty"`
+	Folders  []WatchedFolder `json:"folders,omitempty"`
+	File     *WatchedFile    `json:"file,omitempty"`
+	Path     string          `json:"path,omitempty"`
+	Log      *LogEntry       `json:"log,omitempty"`
+	Logs     []LogEntry      `json:"logs,omitempty"`
+	Reload   string          `json:"reload,omitempty"`   // Type="reload": "page" = full window reload, "css" = fetch the --css stylesheet again
+	Config   *ClientConfig   `json:"config,omitempty"`   // sent with the first "files" message
+	Error    string          `json:"error,omitempty"`    // Type="error": why the connection is refused; Type="shutdown": why the server goes away
+	Cursor   *CursorPosition `json:"cursor,omitempty"`   // Type="cursor": another browser scrolled (--live-cursor)
+	Hash     string          `json:"hash,omitempty"`     // Type="update": SHA-256 of File.HTML, so unchanged renders can be skipped
+	Patch    []Op            `json:"patch,omitempty"`    // Type="update" with --incremental: File.HTML is left out; apply this to the HTML hashing to Base
+	Base     string          `json:"base,omitempty"`     // SHA-256 of the HTML Patch applies to
+	RenderMs int             `json:"renderMs,omitempty"` // Type="update": how long rendering File took, in milliseconds
+}
+
+// ClientConfig carries server-side settings that change browser behavior.
+type ClientConfig struct {
+	ReloadStrategy  string `json:"reloadStrategy"`  // replace, patch or reload
+	ScrollMarginTop int    `json:"scrollMarginTop"` // pixels kept above headings scrolled to
+	CopyExclude     string `json:"copyExclude"`     // CSS selector left out when copying from code blocks
+	LiveCursor      bool   `json:"liveCursor"`      // share scroll positions with other browsers
+	MaxCursors      int    `json:"maxCursors"`      // other browsers' positions shown; 0 = all
+	Math            bool   `json:"math"`            // math arrives as .math-inline/.math-display (--math)
 }
 
 // Client represents a connected WebSocket client
 type Client struct {
-	hub  *Hub
-	conn *websocket.Conn
-	send chan []byte
+	hub       *Hub
+	conn      *websocket.Conn // nil for a Server-Sent Events client (/events)
+	send      chan []byte
+	addr      string    // remote address, for connect/disconnect logs
+	connected time.Time // when the WebSocket was upgraded
+	path      string    // only receive updates for this file ("" = all files)
+	id        string    // names the client's cursor to others (--live-cursor)
+}
+
+// fileMessage is an update for one file, delivered only to the clients
+// subscribed to it (see Client.path).
+type fileMessage struct {
+	path string
+	data []byte
 }
 
 // Hub manages files, watchers, and WebSocket clients
 type Hub struct {
 	clients    map[*Client]bool
 	broadcast  chan []byte
+	updates    chan fileMessage
 	register   chan *Client
 	unregister chan *Client
+	stopped    chan struct{} // closed once RunWithContext has returned
+
+	// --connection-limit-per-ip; clientsByIP is only touched by Run.
+	clientsByIP    map[string]int
+	connLimitPerIP int // 0 = unlimited
+
+	// --live-cursor: readers pass scroll positions to Run on cursors (nil
+	// when off); Run keeps each client's last one in cursorPos.
+	cursors   chan cursorMove
+	cursorPos map[*Client]CursorPosition
 
 	mu        sync.RWMutex
 	files     map[string]*WatchedFile
-	watchers  map[string]*Watcher
+	watchers  map[string]FileWatcher
+	sent      map[string]sentFile // what browsers were last sent of each file
 	folders   map[string]*WatchedFolder
 	folderMgr *FolderManager
 	renderer  *Renderer
 	logger    *Logger
+	config    ClientConfig
+	pdf       *pdfPrinter // nil unless --serve-pdf
+
+	pollNetworkDrives bool          // --watch-network-drive
+	pollAll           bool          // --poll
+	pollEvery         time.Duration // --poll-interval
+	trimHTML          bool          // --trim-html
+	verbose           bool          // --verbose: extra diagnostic log lines
+	titleFromH1       bool          // --title-from-h1
+	createOnly        bool          // --watch-create-only: no per-file watchers; show new files
+	wordLimit         int           // --word-count-threshold: warn about longer markdown; 0 = off
+	incremental       bool          // --incremental: send updates as patches
+
+	retryWatch   int           // --retry-watch: recreate a file watcher after this many consecutive errors
+	watchTimeout time.Duration // --watch-timeout: give up subscribing to a file after this long
+	watchParent  bool          // --watch-parent-dir: also watch each file's directory
+	watchLinks   bool          // --watch-symlinks: follow symlinks that get repointed
+	debounce     time.Duration // --debounce: quiet time before a change is rendered
+
+	// --max-concurrent-renders: a change callback holds a slot while it
+	// renders; nil = unlimited.
+	renderSlots chan struct{}
+
+	// --watch-on-demand: Run sends true on watchPause when the last browser
+	// disconnects and false when the first one connects; watchPaused is the
+	// state runOnDemand last applied (guarded by mu).
+	watchPause  chan bool
+	watchPaused bool
+
+	// Monitoring (see Status). Counters are atomic so the hot paths don't
+	// contend on mu; lastUpdate/lastUpdatePath are guarded by mu.
+	clientCount       atomic.Int64
+	messagesBroadcast atomic.Int64
+	renderErrors      atomic.Int64
+	lastUpdate        time.Time
+	lastUpdatePath    string
+}
+
+// HubStatus is a point-in-time snapshot of the hub, served at /api/status.
+type HubStatus struct {
+	ClientCount       int       `json:"clientCount"`
+	MessagesBroadcast int64     `json:"messagesBroadcast"` // file updates pushed to browsers
+	Errors            int64     `json:"errors"`            // render failures
+	LastUpdate        time.Time `json:"lastUpdate"`
+	CurrentFilename   string    `json:"currentFilename"` // file of the last update
+}
+
+// ClientCount is the number of browsers connected right now. The clients
+// map belongs to Run, so this reads the counter Run keeps in step with it.
+func (h *Hub) ClientCount() int {
+	return int(h.clientCount.Load())
 }
 
-func NewHub() *Hub {
+// Status reports the hub's current state for monitoring.
+func (h *Hub) Status() HubStatus {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return HubStatus{
+		ClientCount:       h.ClientCount(),
+		MessagesBroadcast: h.messagesBroadcast.Load(),
+		Errors:            h.renderErrors.Load(),
+		LastUpdate:        h.lastUpdate,
+		CurrentFilename:   h.lastUpdatePath,
+	}
+}
+
+func NewHub(opts *ServerOptions) *Hub {
 	h := &Hub{
 		clients:    make(map[*Client]bool),
 		broadcast:  make(chan []byte, 256),
+		updates:    make(chan fileMessage, 256),
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
+		stopped:    make(chan struct{}),
 		files:      make(map[string]*WatchedFile),
-		watchers:   make(map[string]*Watcher),
+		watchers:   make(map[string]FileWatcher),
+		sent:       make(map[string]sentFile),
 		folders:    make(map[string]*WatchedFolder),
-		renderer:   NewRenderer(),
-		logger:     NewLogger(100),
+		renderer:   NewRenderer(opts.rendererOptions()...),
+		config: ClientConfig{
+			ReloadStrategy:  opts.ReloadStrategy,
+			ScrollMarginTop: opts.ScrollMargin,
+			CopyExclude:     opts.HighlightCopyExclude,
+			LiveCursor:      opts.LiveCursor,
+			MaxCursors:      opts.MaxCursors,
+			Math:            opts.Math,
+		},
+
+		clientsByIP:       make(map[string]int),
+		connLimitPerIP:    opts.ConnectionLimitPerIP,
+		pollNetworkDrives: opts.WatchNetworkDrive,
+		pollAll:           opts.Poll,
+		pollEvery:         opts.PollInterval,
+		trimHTML:          opts.TrimHTML,
+		verbose:           opts.Verbose,
+		titleFromH1:       opts.TitleFromH1,
+		createOnly:        opts.WatchCreateOnly,
+		wordLimit:         opts.WordCountThreshold,
+		incremental:       opts.Incremental,
+		retryWatch:        opts.RetryWatch,
+		watchTimeout:      opts.WatchTimeout,
+		watchParent:       opts.WatchParentDir,
+		watchLinks:        opts.WatchSymlinks,
+		debounce:          opts.Debounce,
+		logger:            NewLogger(100),
 	}
 	h.logger.SetHub(h)
+	h.logger.mirror = opts.LogJSON
+	if opts.MaxConcurrentRenders > 0 {
+		h.renderSlots = make(chan struct{}, opts.MaxConcurrentRenders)
+	}
+	if opts.LiveCursor {
+		h.cursors = make(chan cursorMove, 256)
+		h.cursorPos = make(map[*Client]CursorPosition)
+	}
 
 	fm, err := NewFolderManager(h)
 	if err != nil {
-		h.logger.Warn(fmt.Sprintf("Could not create folder watcher: %v", err))
+		h.logger.Warn("Could not create folder watcher", "err", err)
 	} else {
 		h.folderMgr = fm
 	}
 
 	h.restoreFromState()
+	if h.verbose {
+		paths := h.WatchedPaths()
+		h.logger.Info("Watching paths at startup", "count", len(paths), "paths", strings.Join(paths, ", "))
+	}
+
+	if opts.WatchOnDemand {
+		h.watchPause = make(chan bool, 1)
+		h.pauseWatching() // nobody is looking yet
+		go h.runOnDemand()
+	}
 	return h
 }
 
+// WatchedPaths returns every path the hub's watchers are subscribed to:
+// watched files (and with --watch-parent-dir their directories) plus the
+// directories of followed folders, sorted and without duplicates.
+func (h *Hub) WatchedPaths() []string {
+	h.mu.RLock()
+	watchers := make([]FileWatcher, 0, len(h.watchers))
+	for _, w := range h.watchers {
+		watchers = append(watchers, w)
+	}
+	fm := h.folderMgr
+	h.mu.RUnlock()
+
+	set := make(map[string]bool)
+	for _, w := range watchers {
+		for _, p := range w.WatchedPaths() {
+			set[p] = true
+		}
+	}
+	if fm != nil {
+		for _, p := range fm.WatchedPaths() {
+			set[p] = true
+		}
+	}
+	return sortedKeys(set)
+}
+
 // persistState writes the current files+folders to disk so they survive restart.
 // Called from any add/remove/toggle path; safe to call from inside a Hub method
 // that is NOT already holding h.mu (it acquires its own RLock).
 func (h *Hub) persistState() {
 	h.mu.RLock()
-	files := make([]StateFile, 0, len(h.files))
-	for _, f := range h.files {
-		files = append(files, StateFile{Path: f.Path, Active: false}) // active is session-scoped
-	}
 	folders := make([]WatchedFolder, 0, len(h.folders))
+	var unsaved []string
 	for _, f := range h.folders {
+		if f.Unsaved {
+			unsaved = append(unsaved, f.Path)
+			continue
+		}
 		folders = append(folders, *f)
 	}
+	files := make([]StateFile, 0, len(h.files))
+next:
+	for _, f := range h.files {
+		for _, dir := range unsaved {
+			if _, ok := relativeTo(dir, f.Path); ok {
+				continue next
+			}
+		}
+		files = append(files, StateFile{Path: f.Path, Active: false}) // active is session-scoped
+	}
 	h.mu.RUnlock()
 
 	if err := saveState(&State{Files: files, Folders: folders}); err != nil {
-		h.logger.Warn(fmt.Sprintf("Persist state: %v", err))
+		h.logger.Warn("Persist state failed", "err", err)
 	}
 }
 
@@ -118,7 +325,7 @@ func (h *Hub) persistState() {
 func (h *Hub) restoreFromState() {
 	state, err := loadState()
 	if err != nil {
-		h.logger.Warn(fmt.Sprintf("Load state: %v", err))
+		h.logger.Warn("Load state failed", "err", err)
 		return
 	}
 
@@ -127,7 +334,7 @@ func (h *Hub) restoreFromState() {
 			continue // file gone, skip silently
 		}
 		if err := h.AddFile(sf.Path); err != nil {
-			h.logger.Warn(fmt.Sprintf("Restore file %s: %v", sf.Path, err))
+			h.logger.Warn("Restore file failed", "path", sf.Path, "err", err)
 		}
 	}
 
@@ -141,7 +348,7 @@ func (h *Hub) restoreFromState() {
 		}
 		files, err := h.folderMgr.Follow(&folder)
 		if err != nil {
-			h.logger.Warn(fmt.Sprintf("Restore folder %s: %v", folder.Path, err))
+			h.logger.Warn("Restore folder failed", "folder", folder.Path, "err", err)
 			continue
 		}
 		h.mu.Lock()
@@ -153,35 +360,344 @@ func (h *Hub) restoreFromState() {
 	}
 }
 
+// Run runs the hub until the process exits.
 func (h *Hub) Run() {
+	h.RunWithContext(context.Background())
+}
+
+// RunWithContext delivers messages to clients and keeps track of them until
+// ctx is cancelled. Then it delivers what is still queued, tells every client
+// the server is shutting down and closes their send channels, after which
+// the hub drops messages and turns new clients away.
+func (h *Hub) RunWithContext(ctx context.Context) {
+	defer close(h.stopped)
 	for {
 		select {
+		case <-ctx.Done():
+			h.stop()
+			return
+
 		case client := <-h.register:
+			ip := clientIP(client.addr)
+			if h.connLimitPerIP > 0 && h.clientsByIP[ip] >= h.connLimitPerIP {
+				data, _ := json.Marshal(Message{Type: "error", Error: fmt.Sprintf("too many connections from %s", ip)})
+				client.send <- data
+				close(client.send) // the writer sends the error, then hangs up
+				h.logger.Warn("Rejected browser: too many connections from its address", "addr", client.addr, "connections", h.clientsByIP[ip])
+				continue
+			}
 			h.clients[client] = true
-			h.logger.Info("Browser connected")
+			h.clientsByIP[ip]++
+			h.clientCount.Store(int64(len(h.clients)))
+			connectedClients.Set(float64(len(h.clients)))
+			h.logger.Info("Browser connected", "addr", client.addr)
+			if len(h.clients) == 1 {
+				h.requestWatchPause(false)
+			}
 			// Send current file list to new client
 			h.sendFileList(client)
+			h.sendCursors(client)
 
 		case client := <-h.unregister:
 			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				close(client.send)
-				h.logger.Info("Browser disconnected")
+				h.removeClient(client)
+				h.logger.Info("Browser disconnected", "addr", client.addr,
+					"connected", time.Since(client.connected).Round(time.Second))
 			}
 
 		case message := <-h.broadcast:
-			for client := range h.clients {
-				select {
-				case client.send <- message:
-				default:
-					close(client.send)
-					delete(h.clients, client)
-				}
-			}
+			h.deliver(message, "", nil)
+
+		case update := <-h.updates:
+			h.deliver(update.data, update.path, nil)
+
+		case move := <-h.cursors:
+			h.relayCursor(move)
+		}
+	}
+}
+
+// stop drains the broadcast queues, so the shutdown message goes out, and
+// closes every client's send channel. Only RunWithContext calls it.
+func (h *Hub) stop() {
+	for drained := false; !drained; {
+		select {
+		case message := <-h.broadcast:
+			h.deliver(message, "", nil)
+		case update := <-h.updates:
+			h.deliver(update.data, update.path, nil)
+		default:
+			drained = true
+		}
+	}
+	for client := range h.clients {
+		h.removeClient(client)
+	}
+}
+
+// publish queues a message for every client, or drops it once the hub has
+// stopped.
+func (h *Hub) publish(data []byte) {
+	select {
+	case h.broadcast <- data:
+	case <-h.stopped:
+	}
+}
+
+// publishFile queues a message for the clients showing path, or drops it
+// once the hub has stopped.
+func (h *Hub) publishFile(path string, data []byte) {
+	select {
+	case h.updates <- fileMessage{path: path, data: data}:
+	case <-h.stopped:
+	}
+}
+
+// join registers a new client, reporting false if the hub has stopped.
+func (h *Hub) join(client *Client) bool {
+	select {
+	case h.register <- client:
+		return true
+	case <-h.stopped:
+		return false
+	}
+}
+
+// leave unregisters a client, which a stopped hub has already let go.
+func (h *Hub) leave(client *Client) {
+	select {
+	case h.unregister <- client:
+	case <-h.stopped:
+	}
+}
+
+// deliver queues message for every client but except, or with path set, for
+// the clients subscribed to that file. Clients whose queue is full are
+// dropped.
+func (h *Hub) deliver(message []byte, path string, except *Client) {
+	for client := range h.clients {
+		if client == except {
+			continue
 		}
+		if path != "" && client.path != "" && !PathsEqual(client.path, path) {
+			continue
+		}
+		select {
+		case client.send <- message:
+		default:
+			h.removeClient(client)
+		}
+	}
+}
+
+// removeClient forgets a registered client and closes its send queue. Only
+// Run calls it.
+func (h *Hub) removeClient(client *Client) {
+	delete(h.clients, client)
+	close(client.send)
+	h.clientCount.Store(int64(len(h.clients)))
+	connectedClients.Set(float64(len(h.clients)))
+	if ip := clientIP(client.addr); h.clientsByIP[ip] <= 1 {
+		delete(h.clientsByIP, ip)
+	} else {
+		h.clientsByIP[ip]--
+	}
+	if len(h.clients) == 0 {
+		h.requestWatchPause(true)
+	}
+	if h.cursorPos != nil {
+		h.forgetCursor(client)
+	}
+}
+
+// clientIP is the host part of a remote address, the key of clientsByIP.
+func clientIP(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+// requestWatchPause hands a pause (true) or resume (false) to runOnDemand
+// without blocking Run. Only the newest request matters, so a pending one
+// that hasn't been picked up yet is replaced.
+func (h *Hub) requestWatchPause(pause bool) {
+	if h.watchPause == nil {
+		return
+	}
+	select {
+	case <-h.watchPause:
+	default:
+	}
+	h.watchPause <- pause
+}
+
+// runOnDemand applies --watch-on-demand pause/resume requests from Run.
+func (h *Hub) runOnDemand() {
+	for pause := range h.watchPause {
+		if pause {
+			h.pauseWatching()
+		} else {
+			h.resumeWatching()
+		}
+	}
+}
+
+// pauseWatching releases every file and folder watch. Active files stay
+// active so resumeWatching knows what to watch again.
+func (h *Hub) pauseWatching() {
+	h.mu.Lock()
+	if h.watchPaused {
+		h.mu.Unlock()
+		return
+	}
+	h.watchPaused = true
+	for path, w := range h.watchers {
+		w.Close()
+		delete(h.watchers, path)
+	}
+	h.mu.Unlock()
+
+	if h.folderMgr != nil {
+		h.folderMgr.Pause()
+	}
+	h.logger.Info("No browsers connected, watching paused")
+}
+
+// resumeWatching restarts the watches released by pauseWatching and catches
+// up on whatever changed in the meantime.
+func (h *Hub) resumeWatching() {
+	h.mu.Lock()
+	if !h.watchPaused {
+		h.mu.Unlock()
+		return
+	}
+	h.watchPaused = false
+	var active []string
+	for path, f := range h.files {
+		if f.Active && !f.Deleted {
+			active = append(active, path)
+		}
+	}
+	h.mu.Unlock()
+
+	h.logger.Info("Browser connected, watching resumed")
+	if h.folderMgr != nil {
+		h.folderMgr.Resume()
+	}
+	for _, path := range active {
+		if h.refreshFile(path) {
+			h.startWatcher(path)
+		}
+	}
+}
+
+// refreshFile re-renders a registered file if it changed on disk and pushes
+// the result to browsers. It reports false if the file is gone.
+func (h *Hub) refreshFile(path string) bool {
+	h.mu.Lock()
+	f, exists := h.files[path]
+	if !exists {
+		h.mu.Unlock()
+		return false
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		f.Deleted = true
+		f.Active = false
+		h.mu.Unlock()
+		h.logger.Warn("File deleted", "file", filepath.Base(path))
+		h.broadcastFileList()
+		return false
+	}
+	if !info.ModTime().After(f.LastChange) {
+		h.mu.Unlock()
+		return true
+	}
+	h.mu.Unlock()
+
+	res, err := h.render(path)
+	if err != nil {
+		h.renderErrors.Add(1)
+		h.logger.Error("Error rendering", "file", filepath.Base(path), "err", err)
+		h.SetError(path, err)
+		return true
+	}
+	warning := h.wordWarning(path)
+
+	h.mu.Lock()
+	if h.files[path] != f {
+		h.mu.Unlock() // removed while it rendered
+		return false
+	}
+	base := f.HTML
+	f.HTML = res.HTML
+	f.Title = h.pageTitle(path, res)
+	f.BrokenLinks = res.BrokenLinks
+	f.LocalFiles = res.LocalFiles
+	f.Warning = warning
+	f.LastChange = info.ModTime()
+	unchanged := h.sameAsBroadcast(path, f)
+	h.lastUpdate = time.Now()
+	h.lastUpdatePath = path
+	updated := *f
+	h.mu.Unlock()
+
+	if !unchanged {
+		h.broadcastFileUpdate(&updated, base, res.Elapsed)
+	}
+	return true
+}
+
+// isActive reports whether path is registered and being watched.
+func (h *Hub) isActive(path string) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	f, exists := h.files[path]
+	return exists && f.Active
+}
+
+// SetError shows err in place of path's content in the browsers showing it,
+// e.g. when the file grew past --max-size. The next successful render
+// replaces it.
+func (h *Hub) SetError(path string, err error) {
+	h.mu.Lock()
+	f, exists := h.files[path]
+	if !exists {
+		h.mu.Unlock()
+		return
+	}
+	base := f.HTML
+	f.HTML = renderErrorMessage(err)
+	unchanged := h.sameAsBroadcast(path, f)
+	updated := *f
+	h.mu.Unlock()
+	if !unchanged {
+		h.broadcastFileUpdate(&updated, base, 0)
 	}
 }
 
+// sentFile is what browsers were last sent of a file: the Message.Hash of
+// its HTML, and its title.
+type sentFile struct {
+	hash  string
+	title string
+}
+
+// sameAsBroadcast reports whether f renders exactly as it did when last sent
+// to browsers, so a save that changes nothing isn't broadcast again, and
+// records it for next time. It sets f.hash. Callers hold h.mu.
+func (h *Hub) sameAsBroadcast(path string, f *WatchedFile) bool {
+	f.hash = contentHash([]byte(f.HTML))
+	sent := sentFile{hash: f.hash, title: f.Title}
+	if h.sent[path] == sent {
+		return true
+	}
+	h.sent[path] = sent
+	return false
+}
+
 // snapshotFilesFolders captures the current file + folder lists under the lock.
 func (h *Hub) snapshotFilesFolders() ([]WatchedFile, []WatchedFolder) {
 	h.mu.RLock()
@@ -199,7 +715,7 @@ func (h *Hub) snapshotFilesFolders() ([]WatchedFile, []WatchedFolder) {
 
 func (h *Hub) sendFileList(client *Client) {
 	files, folders := h.snapshotFilesFolders()
-	msg := Message{Type: "files", Files: files, Folders: folders}
+	msg := Message{Type: "files", Files: files, Folders: folders, Config: &h.config}
 	data, _ := json.Marshal(msg)
 	client.send <- data
 
@@ -213,19 +729,106 @@ func (h *Hub) broadcastFileList() {
 	files, folders := h.snapshotFilesFolders()
 	msg := Message{Type: "files", Files: files, Folders: folders}
 	data, _ := json.Marshal(msg)
-	h.broadcast <- data
+	h.publish(data)
 }
 
-func (h *Hub) broadcastFileUpdate(file *WatchedFile) {
-	msg := Message{Type: "update", File: file}
+// broadcastFileUpdate sends file's new rendering, which took elapsed, to the
+// browsers showing it. base is the HTML they were sent before; with
+// --incremental the message carries a patch from it instead of the whole
+// HTML, when that is smaller.
+func (h *Hub) broadcastFileUpdate(file *WatchedFile, base string, elapsed time.Duration) {
+	msg := Message{Type: "update", File: file, Hash: file.hash, RenderMs: int(elapsed.Milliseconds())}
+	if h.incremental && base != "" {
+		if patch, ok := diffHTML(base, file.HTML); ok {
+			copied := *file
+			copied.HTML = ""
+			msg.File, msg.Patch, msg.Base = &copied, patch, contentHash([]byte(base))
+		}
+	}
 	data, _ := json.Marshal(msg)
-	h.broadcast <- data
+	h.messagesBroadcast.Add(1)
+	broadcastsTotal.Inc()
+	h.publishFile(file.Path, data)
+}
+
+// wordWarning is WatchedFile.Warning for path: why it is longer than
+// --word-count-threshold, or "" if it isn't.
+func (h *Hub) wordWarning(path string) string {
+	if h.wordLimit <= 0 || !isMarkdown(path) {
+		return ""
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	if words := len(strings.Fields(string(content))); words > h.wordLimit {
+		return fmt.Sprintf("Document exceeds %d words (current: %d)", h.wordLimit, words)
+	}
+	return ""
+}
+
+// broadcastSelect tells browsers to switch to path (--watch-create-only).
+func (h *Hub) broadcastSelect(path string) {
+	msg := Message{Type: "select", Path: path}
+	data, _ := json.Marshal(msg)
+	h.publish(data)
+}
+
+// Broadcast sends msg to every connected browser.
+func (h *Hub) Broadcast(msg Message) {
+	data, _ := json.Marshal(msg)
+	h.publish(data)
 }
 
 func (h *Hub) broadcastLog(entry LogEntry) {
 	msg := Message{Type: "log", Log: &entry}
 	data, _ := json.Marshal(msg)
-	h.broadcast <- data
+	h.publish(data)
+}
+
+// watchStaticDir reloads every connected browser when a frontend asset in dir
+// changes (--watch-all). Events are debounced like file watchers so a save
+// that touches several files produces a single reload.
+func (h *Hub) watchStaticDir(dir string) error {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	if err := w.Add(dir); err != nil {
+		w.Close()
+		return err
+	}
+
+	go func() {
+		var timer *time.Timer
+		for {
+			select {
+			case ev, ok := <-w.Events:
+				if !ok {
+					return
+				}
+				if ev.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename|fsnotify.Remove) == 0 {
+					continue
+				}
+				if timer != nil {
+					timer.Stop()
+				}
+				name := filepath.Base(ev.Name)
+				timer = time.AfterFunc(100*time.Millisecond, func() {
+					h.logger.Info("Frontend changed, reloading browsers", "file", name)
+					msg := Message{Type: "reload", Reload: "page"}
+					data, _ := json.Marshal(msg)
+					h.publish(data)
+				})
+			case err, ok := <-w.Errors:
+				if !ok {
+					return
+				}
+				h.logger.Warn("Frontend watcher error", "err", err)
+			}
+		}
+	}()
+	return nil
 }
 
 // FollowFolder registers a folder, runs initial discovery, and starts watching
@@ -258,7 +861,7 @@ func (h *Hub) FollowFolder(folder *WatchedFolder) error {
 		_ = h.AddFile(f) // ignore "already registered"
 	}
 
-	h.logger.Info(fmt.Sprintf("Following folder: %s (%d files)", folder.Path, len(files)))
+	h.logger.Info("Following folder", "folder", folder.Path, "files", len(files))
 	h.broadcastFileList()
 	h.persistState()
 	return nil
@@ -285,7 +888,7 @@ func (h *Hub) UnfollowFolder(path string) error {
 	if h.folderMgr != nil {
 		h.folderMgr.Unfollow(actual)
 	}
-	h.logger.Info(fmt.Sprintf("Unfollowed folder: %s", actual))
+	h.logger.Info("Unfollowed folder", "folder", actual)
 	h.broadcastFileList()
 	h.persistState()
 	return nil
@@ -333,38 +936,52 @@ func (h *Hub) AddFileWithActive(path string, active bool) error {
 		}
 	}
 
+	h.mu.Unlock()
+
 	// Get file info
 	info, err := os.Stat(path)
 	if err != nil {
-		h.mu.Unlock()
 		return err
 	}
 
-	// Render content
-	html, err := h.renderer.Render(path)
+	// Render content, without holding h.mu
+	res, err := h.render(path)
 	if err != nil {
-		h.mu.Unlock()
 		return err
 	}
+	warning := h.wordWarning(path)
+
+	h.mu.Lock()
+	for existingPath := range h.files {
+		if PathsEqual(existingPath, path) {
+			h.mu.Unlock()
+			return fmt.Errorf("already registered: %s", filepath.Base(existingPath))
+		}
+	}
 
 	file := &WatchedFile{
-		Path:       path,
-		Name:       filepath.Base(path),
-		TrackTime:  time.Now(),
-		LastChange: info.ModTime(),
-		HTML:       html,
-		Active:     active,
+		Path:        path,
+		Name:        filepath.Base(path),
+		TrackTime:   time.Now(),
+		LastChange:  info.ModTime(),
+		HTML:        res.HTML,
+		Title:       h.pageTitle(path, res),
+		BrokenLinks: res.BrokenLinks,
+		LocalFiles:  res.LocalFiles,
+		Warning:     warning,
+		Active:      active,
 	}
 	h.files[path] = file
+	h.sameAsBroadcast(path, file) // sent with the file list
 
 	h.mu.Unlock()
 
 	// Only start watcher if active
 	if active {
 		h.startWatcher(path)
-		h.logger.Info(fmt.Sprintf("Started watching: %s", filepath.Base(path)))
+		h.logger.Info("Started watching", "file", filepath.Base(path))
 	} else {
-		h.logger.Info(fmt.Sprintf("Registered: %s", filepath.Base(path)))
+		h.logger.Info("Registered", "file", filepath.Base(path))
 	}
 
 	h.broadcastFileList()
@@ -372,44 +989,182 @@ func (h *Hub) AddFileWithActive(path string, active bool) error {
 	return nil
 }
 
+// render renders path for the browser, applying hub-level post-processing
+// (--trim-html) on top of the Renderer. Malformed front matter is logged;
+// the document still renders.
+func (h *Hub) render(path string) (RenderResult, error) {
+	res, err := h.renderer.Render(path)
+	if err != nil {
+		return res, err
+	}
+	slog.Debug("Rendered", "file", filepath.Base(path), "duration", res.Elapsed)
+	if res.MetaError != nil {
+		h.logger.Warn("Malformed front matter", "file", filepath.Base(path), "err", res.MetaError)
+	}
+	if !h.trimHTML {
+		return res, nil
+	}
+	trimmed := trimHTML(res.HTML)
+	if h.verbose {
+		h.logger.Info("Trimmed HTML", "file", filepath.Base(path), "from", len(res.HTML), "to", len(trimmed))
+	}
+	res.HTML = trimmed
+	return res, nil
+}
+
+// renderSlotTimeout is how long a change waits for a free render slot
+// (--max-concurrent-renders) before it is skipped.
+const renderSlotTimeout = 5 * time.Second
+
+// acquireRender takes a render slot for a change to path, or reports false,
+// with a warning, if none frees up within renderSlotTimeout.
+func (h *Hub) acquireRender(path string) bool {
+	if h.renderSlots == nil {
+		return true
+	}
+	select {
+	case h.renderSlots <- struct{}{}:
+		return true
+	case <-time.After(renderSlotTimeout):
+		h.logger.Warn("Skipped rendering: no render slot free (--max-concurrent-renders)",
+			"file", filepath.Base(path), "waited", renderSlotTimeout)
+		return false
+	}
+}
+
+// releaseRender frees the slot taken by acquireRender.
+func (h *Hub) releaseRender() {
+	if h.renderSlots != nil {
+		<-h.renderSlots
+	}
+}
+
+// prerenderPDF reprints path from html in the background (--prerender-pdf).
+// Saves that come in while path prints are coalesced, so only the latest is
+// printed next, and prints take a --max-concurrent-renders slot like renders.
+func (h *Hub) prerenderPDF(path, html string) {
+	if !h.pdf.prerender || !h.pdf.Available() || !h.pdf.Queue(path, html) {
+		return
+	}
+	go func() {
+		for {
+			html, ok := h.pdf.Next(path)
+			if !ok {
+				return
+			}
+			if !h.acquireRender(path) {
+				continue
+			}
+			err := h.pdf.Update(path, html)
+			h.releaseRender()
+			if err != nil {
+				h.logger.Warn("Prerender PDF failed", "file", filepath.Base(path), "err", err)
+			}
+		}
+	}()
+}
+
+// pageTitle is the browser tab title for a rendered file: its front matter
+// title, else the text of its first <h1> with --title-from-h1, else "" (the
+// client uses the file name).
+func (h *Hub) pageTitle(path string, res RenderResult) string {
+	if title, ok := res.Meta["title"].(string); ok && title != "" {
+		return title
+	}
+	if !h.titleFromH1 || !isMarkdown(path) {
+		return ""
+	}
+	return firstH1Text(res.HTML)
+}
+
 func (h *Hub) startWatcher(path string) {
+	if h.createOnly {
+		// Files are rendered once, when created or opened; modifications
+		// and removals are deliberately not tracked.
+		return
+	}
 	h.mu.Lock()
 	// Check if watcher already exists
 	if _, exists := h.watchers[path]; exists {
 		h.mu.Unlock()
 		return
 	}
+	if h.watchPaused {
+		// --watch-on-demand: resumeWatching starts it once a browser connects.
+		h.mu.Unlock()
+		return
+	}
 
-	watcher := NewWatcher()
+	// The file's own watcher is also used for the files it includes.
+	watcher := newIncludingWatcher(h.newFileWatcher(path), h.newFileWatcher)
 	h.watchers[path] = watcher
 	h.mu.Unlock()
 
 	// Watch for changes
-	watcher.Watch(path, func() {
-		h.mu.Lock()
-		f, exists := h.files[path]
-		if !exists || !f.Active {
-			h.mu.Unlock()
+	var onChange func()
+	onChange = func() {
+		if !h.acquireRender(path) {
 			return
 		}
+		defer h.releaseRender()
 
-		html, err := h.renderer.Render(path)
+		if !h.isActive(path) {
+			return
+		}
+
+		// Rendered without h.mu, so a slow file doesn't hold up the
+		// others or the browsers reading the file list.
+		res, err := h.render(path)
 		if err != nil {
-			h.logger.Error(fmt.Sprintf("Error rendering %s: %v", filepath.Base(path), err))
-			h.mu.Unlock()
+			h.renderErrors.Add(1)
+			h.logger.Error("Error rendering", "file", filepath.Base(path), "err", err)
+			h.SetError(path, err)
 			return
 		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return // removed again; the watcher reports that
+		}
+		warning := h.wordWarning(path)
 
-		info, _ := os.Stat(path)
-		f.HTML = html
+		h.mu.Lock()
+		f, exists := h.files[path]
+		if !exists || !f.Active {
+			// Removed or deactivated while it rendered.
+			h.mu.Unlock()
+			return
+		}
+		base := f.HTML
+		f.HTML = res.HTML
+		f.Title = h.pageTitle(path, res)
+		f.BrokenLinks = res.BrokenLinks
+		f.LocalFiles = res.LocalFiles
+		f.Warning = warning
 		f.LastChange = info.ModTime()
+		// A file coming back is news even if it renders as before.
+		unchanged := h.sameAsBroadcast(path, f) && !f.Deleted
+		h.lastUpdate = time.Now()
+		h.lastUpdatePath = path
 		f.Deleted = false // file is back if it was marked deleted
+		updated := *f
 		h.mu.Unlock()
+		watcher.SetIncludes(res.Includes, onChange)
 
-		h.logger.Info(fmt.Sprintf("File changed: %s", filepath.Base(path)))
-		h.broadcastFileUpdate(f)
-	}, func() {
-		// onDelete callback
+		if unchanged {
+			if h.verbose {
+				h.logger.Info("Unchanged output, not broadcast", "file", filepath.Base(path))
+			}
+			return
+		}
+
+		h.logger.Info("File changed", "file", filepath.Base(path))
+		h.broadcastFileUpdate(&updated, base, res.Elapsed)
+
+		if h.pdf != nil {
+			h.prerenderPDF(path, res.HTML)
+		}
+	}
+	onDelete := func() {
 		h.mu.Lock()
 		f, exists := h.files[path]
 		if !exists {
@@ -420,9 +1175,56 @@ func (h *Hub) startWatcher(path string) {
 		f.Active = false
 		h.mu.Unlock()
 
-		h.logger.Warn(fmt.Sprintf("File deleted: %s", filepath.Base(path)))
+		h.logger.Warn("File deleted", "file", filepath.Base(path))
 		h.broadcastFileList()
-	})
+	}
+	err := watcher.Watch(path, onChange, onDelete)
+	if errors.Is(err, errWatchTimeout) {
+		// The filesystem may not deliver events at all (--watch-timeout):
+		// poll this file and its includes instead, as --poll would.
+		h.logger.Warn("Watching timed out; polling the file instead. Use --poll to skip the wait",
+			"file", filepath.Base(path), "timeout", h.watchTimeout, "filesystem", filesystemType(path))
+		polling := newIncludingWatcher(NewPollingWatcher(h.pollEvery), func(string) FileWatcher {
+			return NewPollingWatcher(h.pollEvery)
+		})
+		h.mu.Lock()
+		if h.watchers[path] != watcher {
+			h.mu.Unlock() // stopped while it timed out
+			polling.Close()
+			return
+		}
+		h.watchers[path] = polling
+		h.mu.Unlock()
+		watcher.Close()
+		watcher = polling
+		err = watcher.Watch(path, onChange, onDelete)
+	}
+	if err == nil {
+		watcher.SetIncludes(h.renderer.Includes(path), onChange)
+	}
+}
+
+// newFileWatcher returns the FileWatcher for path that the watch flags ask
+// for, not yet watching.
+func (h *Hub) newFileWatcher(path string) FileWatcher {
+	if h.pollAll {
+		return NewPollingWatcher(h.pollEvery)
+	}
+	if h.pollNetworkDrives && isNetworkDrive(path) {
+		h.logger.Info("Polling network drive", "file", filepath.Base(path))
+		return NewPollingWatcher(h.pollEvery)
+	}
+	notifier := NewWatcher(h.debounce)
+	notifier.RetryAfter = h.retryWatch
+	notifier.AddTimeout = h.watchTimeout
+	notifier.WatchParent = h.watchParent
+	notifier.WatchSymlinks = h.watchLinks
+	notifier.OnFail = func(err error) {
+		h.logger.Error("Watcher failed permanently", "file", filepath.Base(path), "err", err)
+		// Say so in the browser too, or the page silently stops updating.
+		h.SetError(path, fmt.Errorf("Watcher failed permanently: %v", err))
+	}
+	return notifier
 }
 
 func (h *Hub) ActivateFile(path string) error {
@@ -448,24 +1250,42 @@ func (h *Hub) ActivateFile(path string) error {
 		h.mu.Unlock()
 		return nil // Already active
 	}
+	h.mu.Unlock()
 
-	// Refresh content before activating
-	html, err := h.renderer.Render(actualPath)
+	// Refresh content before activating, without holding h.mu
+	res, err := h.render(actualPath)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(actualPath)
 	if err != nil {
-		h.mu.Unlock()
 		return err
 	}
+	warning := h.wordWarning(actualPath)
 
-	info, _ := os.Stat(actualPath)
-	file.HTML = html
+	h.mu.Lock()
+	if h.files[actualPath] != file {
+		h.mu.Unlock()
+		return fmt.Errorf("file not registered: %s", path)
+	}
+	if file.Active {
+		h.mu.Unlock()
+		return nil // activated by another request while this one rendered
+	}
+	file.HTML = res.HTML
+	file.Title = h.pageTitle(actualPath, res)
+	file.BrokenLinks = res.BrokenLinks
+	file.LocalFiles = res.LocalFiles
+	file.Warning = warning
 	file.LastChange = info.ModTime()
 	file.Active = true
+	h.sameAsBroadcast(actualPath, file) // sent with the file list
 	h.mu.Unlock()
 
 	// Start watching
 	h.startWatcher(actualPath)
 
-	h.logger.Info(fmt.Sprintf("Activated watching: %s", filepath.Base(actualPath)))
+	h.logger.Info("Activated watching", "file", filepath.Base(actualPath))
 	h.broadcastFileList()
 	return nil
 }
@@ -504,7 +1324,7 @@ func (h *Hub) DeactivateFile(path string) error {
 
 	h.mu.Unlock()
 
-	h.logger.Info(fmt.Sprintf("Deactivated watching: %s", filepath.Base(actualPath)))
+	h.logger.Info("Deactivated watching", "file", filepath.Base(actualPath))
 	h.broadcastFileList()
 	return nil
 }
@@ -536,14 +1356,15 @@ func (h *Hub) RemoveFile(path string) error {
 	}
 
 	delete(h.files, actualPath)
+	delete(h.sent, actualPath)
 	h.mu.Unlock()
 
-	h.logger.Info(fmt.Sprintf("Stopped watching: %s", name))
+	h.logger.Info("Stopped watching", "file", name)
 
 	// Broadcast removal
 	msg := Message{Type: "removed", Path: actualPath}
 	data, _ := json.Marshal(msg)
-	h.broadcast <- data
+	h.publish(data)
 
 	h.persistState()
 	return nil
@@ -564,6 +1385,7 @@ func (h *Hub) RemoveFolder(folderPath string) int {
 			delete(h.watchers, path)
 		}
 		delete(h.files, path)
+		delete(h.sent, path)
 	}
 	// If this matches a followed folder root, also unfollow so we stop auto-adding.
 	var unfollow string
@@ -583,7 +1405,7 @@ func (h *Hub) RemoveFolder(folderPath string) int {
 	}
 
 	if len(toRemove) > 0 {
-		h.logger.Info(fmt.Sprintf("Removed %d file(s) from folder: %s", len(toRemove), filepath.Base(folderPath)))
+		h.logger.Info("Removed files of folder", "folder", filepath.Base(folderPath), "files", len(toRemove))
 		h.broadcastFileList()
 		h.persistState()
 	}
@@ -604,11 +1426,12 @@ func (h *Hub) RemoveDeletedFiles() int {
 			delete(h.watchers, path)
 		}
 		delete(h.files, path)
+		delete(h.sent, path)
 	}
 	h.mu.Unlock()
 
 	if len(toRemove) > 0 {
-		h.logger.Info(fmt.Sprintf("Removed %d deleted file(s)", len(toRemove)))
+		h.logger.Info("Removed deleted files", "files", len(toRemove))
 		h.broadcastFileList()
 		h.persistState()
 	}
@@ -635,41 +1458,126 @@ func (h *Hub) Close() {
 	}
 }
 
-// Server handles HTTP and WebSocket
-type Server struct {
-	hub    *Hub
-	port   int
-	server *http.Server
-}
+// Server handles HTTP and WebSocket
+type Server struct {
+	hub    *Hub
+	port   int
+	opts   *ServerOptions
+	server *http.Server
+	head   *htmlFragment // --inject-head; nil = none
+	page   *htmlFragment // --template, served at / instead of index.html; nil = none
+	taskMu sync.Mutex    // serializes /api/toggle-task writes
+
+	stopHub context.CancelFunc // ends hub.RunWithContext when the server shuts down
+}
+
+// injectedHead renders the --inject-head fragment for a page. A broken
+// template is logged and left out rather than failing the page.
+func (s *Server) injectedHead(data fragmentData) string {
+	if s.head == nil {
+		return ""
+	}
+	markup, err := s.head.render(data)
+	if err != nil {
+		s.hub.logger.Warn("--inject-head failed", "err", err)
+		return ""
+	}
+	return markup + "\n"
+}
+
+// defaultPingInterval is how often the server pings each WebSocket client
+// unless --ping-interval says otherwise. Pongs (and any other client message)
+// push the read deadline --client-timeout ahead, so a client that stops
+// answering is dropped within the ping interval + timeout.
+const defaultPingInterval = 30 * time.Second
+
+// pingPeriod is how often a client is pinged: interval, shortened if need
+// be so a ping goes out before the read deadline timeout can pass.
+func pingPeriod(interval, timeout time.Duration) time.Duration {
+	if interval >= timeout {
+		interval = timeout * 9 / 10
+	}
+	return max(interval, time.Millisecond) // time.NewTicker panics on 0
+}
+
+// defaultShutdownGrace is how long the server waits between telling browsers
+// it is shutting down and closing the listener, unless --shutdown-grace says
+// otherwise.
+const defaultShutdownGrace = 2 * time.Second
 
+// upgrader offers permessage-deflate, which rendered HTML compresses well
+// under; handleWebSocket turns it off with --no-ws-compress.
 var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-	CheckOrigin:     func(r *http.Request) bool { return true },
+	ReadBufferSize:    1024,
+	WriteBufferSize:   1024,
+	CheckOrigin:       func(r *http.Request) bool { return true },
+	EnableCompression: true,
+}
+
+// notifyShutdown tells connected browsers the server is going away and
+// gives the message --shutdown-grace to reach them, then stops the hub, which
+// disconnects them, before the caller closes the listener. With no browser
+// connected it doesn't wait.
+func (s *Server) notifyShutdown() {
+	if s.hub.ClientCount() > 0 {
+		s.hub.Broadcast(Message{Type: "shutdown", Error: "Server is shutting down"})
+		time.Sleep(s.opts.ShutdownGrace)
+	}
+	s.stopHub()
+	<-s.hub.stopped
 }
 
 func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+	up := upgrader
+	up.EnableCompression = !s.opts.NoWSCompress
+	conn, err := up.Upgrade(w, r, nil)
 	if err != nil {
-		log.Printf("WebSocket upgrade error: %v", err)
+		slog.Warn("WebSocket upgrade failed", "addr", r.RemoteAddr, "err", err)
 		return
 	}
+	// Only takes effect if the browser agreed to compression.
+	conn.EnableWriteCompression(!s.opts.NoWSCompress)
 
 	client := &Client{
-		hub:  s.hub,
-		conn: conn,
-		send: make(chan []byte, 256),
+		hub:       s.hub,
+		conn:      conn,
+		send:      make(chan []byte, 256),
+		addr:      r.RemoteAddr,
+		connected: time.Now(),
+		path:      r.URL.Query().Get("path"),
+		id:        newClientID(),
 	}
 
-	s.hub.register <- client
+	if !s.hub.join(client) {
+		conn.Close()
+		return
+	}
+
+	timeout := s.opts.ClientTimeout
+	period := pingPeriod(s.opts.PingInterval, timeout)
 
 	// Writer goroutine
 	go func() {
-		defer conn.Close()
-		for message := range client.send {
-			conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
-			if err := conn.WriteMessage(websocket.TextMessage, message); err != nil {
-				return
+		ticker := time.NewTicker(period)
+		defer func() {
+			ticker.Stop()
+			conn.Close()
+		}()
+		for {
+			select {
+			case message, ok := <-client.send:
+				if !ok {
+					return
+				}
+				conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+				if err := conn.WriteMessage(websocket.TextMessage, message); err != nil {
+					return
+				}
+			case <-ticker.C:
+				conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+				if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+					return
+				}
 			}
 		}
 	}()
@@ -677,13 +1585,22 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	// Reader goroutine (detect disconnect)
 	go func() {
 		defer func() {
-			s.hub.unregister <- client
+			s.hub.leave(client)
 			conn.Close()
 		}()
+		conn.SetReadDeadline(time.Now().Add(timeout))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(timeout))
+		})
 		for {
-			if _, _, err := conn.ReadMessage(); err != nil {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
 				break
 			}
+			conn.SetReadDeadline(time.Now().Add(timeout))
+			if s.hub.cursors != nil {
+				s.hub.moveCursor(client, data)
+			}
 		}
 	}()
 }
@@ -717,11 +1634,205 @@ func (s *Server) handleRaw(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// --last-modified-header: with an ETag set, ServeFile also answers
+	// If-None-Match with 304. It always sends Last-Modified and honors
+	// If-Modified-Since.
+	if s.opts.LastModifiedHeader {
+		if etag, err := fileETag(actual); err == nil {
+			w.Header().Set("ETag", etag)
+		}
+	}
+
 	// http.ServeFile handles range requests (important for video seeking) and
 	// sets Content-Type from the extension.
 	http.ServeFile(w, r, actual)
 }
 
+// handleLocalFile serves /file/<path> when a watched markdown file links to
+// path and it is inside that file's directory, for the images and links the
+// renderer pointed there (see localFileLinks). Everything else, directories
+// and dotfiles included, is a 404.
+func (s *Server) handleLocalFile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	path := filepath.Clean(localFilePath(strings.TrimPrefix(r.URL.Path, "/file/")))
+
+	s.hub.mu.RLock()
+	allowed := false
+	for k, f := range s.hub.files {
+		if isMarkdown(k) && linksTo(f, path) && withinDir(filepath.Dir(k), path) {
+			rel, _ := relativeTo(filepath.Dir(k), path)
+			allowed = !hiddenPath(rel)
+			break
+		}
+	}
+	s.hub.mu.RUnlock()
+	if !allowed {
+		http.NotFound(w, r)
+		return
+	}
+	if info, err := os.Stat(path); err != nil || info.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+	http.ServeFile(w, r, path)
+}
+
+// linksTo reports whether f's rendered HTML links to path at /file/.
+func linksTo(f *WatchedFile, path string) bool {
+	for _, linked := range f.LocalFiles {
+		if PathsEqual(linked, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// withinDir reports whether path is below dir, both as written and with
+// symlinks resolved, so neither ../ nor a link can lead out of it.
+func withinDir(dir, path string) bool {
+	if _, ok := relativeTo(dir, path); !ok {
+		return false
+	}
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return false
+	}
+	realPath, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return false
+	}
+	_, ok := relativeTo(realDir, realPath)
+	return ok
+}
+
+// fileETag is a strong ETag for the file at path: the SHA-256 of its content.
+func fileETag(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	sum := sha256.New()
+	if _, err := io.Copy(sum, f); err != nil {
+		return "", err
+	}
+	return `"` + hex.EncodeToString(sum.Sum(nil)) + `"`, nil
+}
+
+// etagMatches reports whether an If-None-Match header lists etag, or is "*".
+// Weak tags match their strong form, as RFC 9110 has for GET.
+func etagMatches(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == etag || tag == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// notModifiedSince reports whether an If-Modified-Since header is a date no
+// earlier than modified, to the second as HTTP dates go.
+func notModifiedSince(header string, modified time.Time) bool {
+	if header == "" || modified.IsZero() {
+		return false
+	}
+	since, err := http.ParseTime(header)
+	if err != nil {
+		return false
+	}
+	return !modified.Truncate(time.Second).After(since)
+}
+
+// fileContent returns a copy of the watched file requested (default: the
+// most recently changed one), rendering it if it is inactive and so hasn't
+// been rendered yet. found is false if there is no such file; err is why
+// rendering failed.
+func (s *Server) fileContent(requested string) (copied WatchedFile, found bool, err error) {
+	s.hub.mu.RLock()
+	var file *WatchedFile
+	for k, f := range s.hub.files {
+		if requested != "" && PathsEqual(k, requested) {
+			file = f
+			break
+		}
+		if requested == "" && !f.Deleted && (file == nil || f.LastChange.After(file.LastChange)) {
+			file = f
+		}
+	}
+	if file != nil {
+		copied = *file
+	}
+	s.hub.mu.RUnlock()
+	if file == nil {
+		return copied, false, nil
+	}
+
+	// Inactive files aren't rendered until selected; render them on demand.
+	if copied.HTML == "" && !copied.Deleted {
+		var res RenderResult
+		res, err = s.hub.render(copied.Path)
+		copied.HTML, copied.BrokenLinks = res.HTML, res.BrokenLinks
+	}
+	return copied, true, err
+}
+
+// handleAPIContent returns the rendered HTML of ?path= (default: the most
+// recently changed file) for scripts that don't speak WebSocket: a "content"
+// Message as JSON, or just the HTML if the client accepts text/html.
+func (s *Server) handleAPIContent(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	copied, found, err := s.fileContent(r.URL.Query().Get("path"))
+	if !found {
+		http.NotFound(w, r)
+		return
+	}
+	msg := Message{Type: "content", File: &copied}
+	if err != nil {
+		msg.Error = err.Error()
+	}
+	msg.Hash = contentHash([]byte(copied.HTML))
+
+	w.Header().Set("Cache-Control", "no-store")
+	if s.opts.LastModifiedHeader && msg.Error == "" {
+		// --last-modified-header: a poller sends the ETag or date back and
+		// gets a 304 until the file renders differently or changes on disk.
+		// As in http.ServeContent, If-None-Match wins over If-Modified-Since.
+		etag := `"` + msg.Hash + `"`
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Vary", "Accept")
+		if !copied.LastChange.IsZero() {
+			w.Header().Set("Last-Modified", copied.LastChange.UTC().Format(http.TimeFormat))
+		}
+		if match := r.Header.Get("If-None-Match"); match != "" {
+			if etagMatches(match, etag) {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		} else if notModifiedSince(r.Header.Get("If-Modified-Since"), copied.LastChange) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+	if strings.Contains(r.Header.Get("Accept"), "text/html") {
+		if msg.Error != "" {
+			http.Error(w, msg.Error, http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		io.WriteString(w, copied.HTML)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(msg)
+}
+
 func (s *Server) handleAddFile(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		Path   string `json:"path"`
@@ -797,6 +1908,39 @@ func (s *Server) handleLogs(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(logs)
 }
 
+// handlePing answers load-balancer probes. Deliberately touches no Hub state
+// so it stays cheap and can't block on the mutex.
+func (s *Server) handlePing(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("pong\n"))
+}
+
+// handleHealth is the readiness probe for container orchestrators: 200 with
+// the client count and the file of the last update.
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	status := s.hub.Status()
+	file := ""
+	if status.CurrentFilename != "" {
+		file = filepath.Base(status.CurrentFilename)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(struct {
+		Status  string `json:"status"`
+		Clients int    `json:"clients"`
+		File    string `json:"file"`
+	}{"ok", status.ClientCount, file})
+}
+
 func (s *Server) handleReleases(w http.ResponseWriter, r *http.Request) {
 	releases, err := fetchAllReleases()
 	if err != nil {
@@ -813,37 +1957,319 @@ func (s *Server) handleVersion(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(info)
 }
 
-func StartServer(port int) {
-	hub := NewHub()
-	go hub.Run()
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(s.hub.Status())
+}
 
-	// Restore previously watched files
-	
+// handleWatcherPaths lists what the daemon's watchers are subscribed to, for
+// debugging files that don't update.
+func (s *Server) handleWatcherPaths(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(s.hub.WatchedPaths())
+}
 
-	s := &Server{
-		hub:  hub,
-		port: port,
+// handlePDF prints a watched file to PDF (--serve-pdf). The query parameter
+// `path` is allowlisted the same way as /raw.
+func (s *Server) handlePDF(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	printer := s.hub.pdf
+	if !printer.Available() {
+		http.Error(w, errNoChromium.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	requested := r.URL.Query().Get("path")
+	if requested == "" {
+		http.Error(w, "Missing path", http.StatusBadRequest)
+		return
 	}
 
-	mux := http.NewServeMux()
+	s.hub.mu.RLock()
+	var actual string
+	for k := range s.hub.files {
+		if PathsEqual(k, requested) {
+			actual = k
+			break
+		}
+	}
+	s.hub.mu.RUnlock()
+	if actual == "" {
+		http.NotFound(w, r)
+		return
+	}
 
-	// Serve index.html at root
-	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		if r.URL.Path != "/" {
-			http.NotFound(w, r)
+	res, err := s.hub.render(actual)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	html := res.HTML
+	pdf, ok := printer.Cached(actual, html)
+	if !ok {
+		if pdf, err = printer.Print(actual, html); err != nil {
+			s.hub.logger.Error("PDF failed", "file", filepath.Base(actual), "err", err)
+			http.Error(w, "PDF generation failed: "+err.Error(), http.StatusInternalServerError)
 			return
 		}
-		data, _ := staticFiles.ReadFile("static/index.html")
-		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	}
+
+	name := strings.TrimSuffix(filepath.Base(actual), filepath.Ext(actual)) + ".pdf"
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", name))
+	w.Write(pdf)
+}
+
+// noDirFS hides directories from http.FileServer so /files/ never produces a
+// listing: opening a directory reports fs.ErrNotExist, which becomes a 404.
+type noDirFS struct {
+	fs.FS
+}
+
+func (n noDirFS) Open(name string) (fs.File, error) {
+	f, err := n.FS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if info.IsDir() {
+		f.Close()
+		return nil, fs.ErrNotExist
+	}
+	return f, nil
+}
+
+// loadFavicon returns the icon served at /favicon.ico: the --favicon-file if
+// it can be read, otherwise the embedded default.
+func loadFavicon(path string, logger *Logger) ([]byte, string) {
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err == nil {
+			contentType := mime.TypeByExtension(filepath.Ext(path))
+			if contentType == "" {
+				contentType = http.DetectContentType(data)
+			}
+			return data, contentType
+		}
+		logger.Warn("Could not read favicon, using default", "path", path, "err", err)
+	}
+	data, _ := staticFiles.ReadFile("static/favicon.svg")
+	return data, "image/svg+xml"
+}
+
+// handleFavicon serves a fixed icon. It only changes when the server
+// restarts, so browsers may cache it for a week.
+func handleFavicon(data []byte, contentType string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Cache-Control", "public, max-age=604800")
 		w.Write(data)
+	}
+}
+
+// handleStylesheet serves generated CSS that is fixed for the server's
+// lifetime.
+func handleStylesheet(css []byte) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/css; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Write(css)
+	}
+}
+
+// defaultWSPath and defaultStaticPath are where the WebSocket endpoint and
+// static/ are served unless --ws-path or --static-path move them.
+const (
+	defaultWSPath     = "/ws"
+	defaultStaticPath = "/static/"
+)
+
+// fixedRoutes are the paths StartServer registers regardless of flags (some
+// only with their flag, but never anything else), which --ws-path and
+// --static-path must not shadow. Entries ending in "/" cover their subtree.
+var fixedRoutes = []string{
+	"/", "/api/", "/raw", "/events", "/favicon.ico", "/ping", "/health", "/metrics", "/qr", "/pdf",
+	"/files/", "/file/", "/chroma.css", "/chroma-dark.css", "/custom.css",
+}
+
+// checkRoutePaths rejects a --ws-path/--static-path that is malformed or
+// collides with another route, naming the routes it conflicts with.
+func checkRoutePaths(wsPath, staticPath string) error {
+	if !strings.HasPrefix(wsPath, "/") || strings.HasSuffix(wsPath, "/") {
+		return fmt.Errorf("--ws-path %q must start with / and not end with /", wsPath)
+	}
+	if !strings.HasPrefix(staticPath, "/") || !strings.HasSuffix(staticPath, "/") || staticPath == "/" {
+		return fmt.Errorf("--static-path %q must start and end with / and not be /", staticPath)
+	}
+	for _, p := range []struct{ flag, path string }{{"--ws-path", wsPath}, {"--static-path", staticPath}} {
+		var conflicts []string
+		for _, route := range fixedRoutes {
+			if routesOverlap(p.path, route) {
+				conflicts = append(conflicts, route)
+			}
+		}
+		if len(conflicts) > 0 {
+			return fmt.Errorf("%s %s conflicts with route(s): %s", p.flag, p.path, strings.Join(conflicts, ", "))
+		}
+	}
+	if routesOverlap(wsPath, staticPath) {
+		return fmt.Errorf("--ws-path %s is inside --static-path %s", wsPath, staticPath)
+	}
+	return nil
+}
+
+// routesOverlap reports whether two ServeMux patterns would claim the same
+// requests. "/" only claims what nothing else does, so it overlaps just "/".
+func routesOverlap(a, b string) bool {
+	if a == b {
+		return true
+	}
+	if a == "/" || b == "/" {
+		return false
+	}
+	return (strings.HasSuffix(a, "/") && strings.HasPrefix(b, a)) ||
+		(strings.HasSuffix(b, "/") && strings.HasPrefix(a, b))
+}
+
+// serverHeader sets the Server response header before delegating to next.
+// It is the outermost handler so even error responses from the mux carry it.
+func serverHeader(next http.Handler, opts *ServerOptions) http.Handler {
+	if opts.HideServerHeader {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", opts.ServerName)
+		next.ServeHTTP(w, r)
 	})
+}
 
-	// Serve static files
+// newServer sets up the hub, running, and the routes of a server for port,
+// ready to serve.
+func newServer(port int, opts *ServerOptions) *Server {
+	hub := NewHub(opts)
+	if opts.ServePDF {
+		hub.pdf = newPDFPrinter(opts, port)
+		if !hub.pdf.Available() {
+			hub.logger.Warn("--serve-pdf: " + errNoChromium.Error())
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go hub.RunWithContext(ctx)
+
+	// Restore previously watched files
+
+	s := &Server{
+		hub:     hub,
+		port:    port,
+		opts:    opts,
+		stopHub: cancel,
+	}
+
+	mux := http.NewServeMux()
+
+	// Frontend assets come from the embedded copy, or straight from disk with
+	// --watch-all so edits show up on the reload it triggers.
 	staticFS, _ := fs.Sub(staticFiles, "static")
-	mux.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.FS(staticFS))))
+	if opts.WatchAll {
+		staticFS = os.DirFS(opts.StaticDir)
+		if err := hub.watchStaticDir(opts.StaticDir); err != nil {
+			hub.logger.Warn("Could not watch frontend assets", "dir", opts.StaticDir, "err", err)
+		} else {
+			hub.logger.Info("Watching frontend assets", "dir", opts.StaticDir)
+		}
+	}
+
+	// Markup added to index.html's <head> by the flags below.
+	var headExtra string
+	if opts.WSPath != defaultWSPath {
+		headExtra += fmt.Sprintf(`<meta name="livemd-ws-path" content="%s">`, html.EscapeString(opts.WSPath)) + "\n"
+	}
+	if opts.InjectHead != "" {
+		s.head = newHTMLFragment(opts.InjectHead)
+	}
+	if opts.PageTemplate != "" {
+		s.page = newHTMLFragment(opts.PageTemplate)
+	}
+
+	// --highlight-theme-dark: code is highlighted with CSS classes, styled per
+	// color scheme by two generated stylesheets.
+	if opts.HighlightThemeDark != "" {
+		mux.HandleFunc("/chroma.css", handleStylesheet(highlightStylesheet(opts.HighlightThemeLight)))
+		mux.HandleFunc("/chroma-dark.css", handleStylesheet(highlightStylesheet(opts.HighlightThemeDark)))
+		headExtra += `<link rel="stylesheet" href="/chroma.css" media="(prefers-color-scheme: light)">` + "\n" +
+			`<link rel="stylesheet" href="/chroma-dark.css" media="(prefers-color-scheme: dark)">` + "\n"
+	}
+
+	if opts.ServeMultiple != "" {
+		// One page per markdown file, and an index of them at root.
+		s.serveMultiple(mux, opts.ServeMultiple, headExtra)
+	} else {
+		// Serve index.html, or the --template page, at root
+		mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/" {
+				http.NotFound(w, r)
+				return
+			}
+			if s.page != nil {
+				s.servePage(w, r, headExtra)
+				return
+			}
+			tmpl, err := indexTemplate(staticFS)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			executePage(w, tmpl.Execute, pageData{
+				Title:  "LiveMD",
+				Head:   template.HTML(headExtra + s.customCSSLink() + s.injectedHead(fragmentData{Title: "LiveMD"})),
+				Static: opts.StaticPath,
+				Port:   port,
+			})
+		})
+	}
+
+	mux.HandleFunc("/favicon.ico", handleFavicon(loadFavicon(opts.FaviconFile, hub.logger)))
+
+	// Serve static files
+	mux.Handle(opts.StaticPath, http.StripPrefix(opts.StaticPath, http.FileServer(http.FS(staticFS))))
+
+	// Optional: expose a directory (default: where `livemd start` ran) so the
+	// browser can fetch images and attachments referenced by markdown.
+	if opts.ServeDir {
+		dirFS := noDirFS{os.DirFS(opts.ServeDirRoot)}
+		mux.Handle("/files/", http.StripPrefix("/files/", http.FileServer(http.FS(dirFS))))
+		hub.logger.Info("Serving directory at /files/", "dir", opts.ServeDirRoot)
+	}
+
+	// --css: a stylesheet of the user's, reloaded in browsers when it changes
+	if opts.CustomCSS != "" {
+		mux.HandleFunc("/custom.css", s.handleCustomCSS)
+		if err := hub.watchCustomCSS(opts.CustomCSS); err != nil {
+			hub.logger.Warn("Could not watch stylesheet", "file", opts.CustomCSS, "err", err)
+		}
+	}
+
+	// Files next to watched markdown, which its relative links point at.
+	if opts.servesLocalFiles() {
+		mux.HandleFunc("/file/", s.handleLocalFile)
+	}
 
 	// WebSocket endpoint
-	mux.HandleFunc("/ws", s.handleWebSocket)
+	mux.HandleFunc(opts.WSPath, s.handleWebSocket)
+	// Same messages as Server-Sent Events, for proxies that block WebSocket
+	mux.HandleFunc("/events", s.handleEvents)
 
 	// API endpoints
 	// Raw file content for non-text viewers (images, PDFs, audio, video).
@@ -861,6 +2287,8 @@ func StartServer(port int) {
 		}
 	})
 	mux.HandleFunc("/api/files", s.handleListFiles)
+	mux.HandleFunc("/api/content", s.handleAPIContent)
+	mux.HandleFunc("/api/toggle-task", s.handleToggleTask)
 	mux.HandleFunc("/api/files/activate", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -948,9 +2376,26 @@ func StartServer(port int) {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]int{"removed": count})
 	})
+	if !opts.NoHealth {
+		mux.HandleFunc("/health", s.handleHealth)
+	}
+	if opts.PingEndpoint {
+		mux.HandleFunc("/ping", s.handlePing)
+	}
+	if opts.Metrics {
+		mux.Handle("/metrics", promhttp.Handler())
+	}
+	if opts.Socket == "" {
+		mux.HandleFunc("/qr", s.handleQR)
+	}
 	mux.HandleFunc("/api/logs", s.handleLogs)
 	mux.HandleFunc("/api/releases", s.handleReleases)
 	mux.HandleFunc("/api/version", s.handleVersion)
+	mux.HandleFunc("/api/status", s.handleStatus)
+	mux.HandleFunc("/api/watcher/paths", s.handleWatcherPaths)
+	if opts.ServePDF {
+		mux.HandleFunc("/pdf", s.handlePDF)
+	}
 	mux.HandleFunc("/api/remove", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodDelete {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -962,15 +2407,33 @@ func StartServer(port int) {
 		w.WriteHeader(http.StatusOK)
 		go func() {
 			time.Sleep(100 * time.Millisecond)
-			hub.Close()
-			s.server.Shutdown(context.Background())
+			s.shutdown()
 		}()
 	})
 
 	s.server = &http.Server{
-		Addr:    fmt.Sprintf(":%d", port),
-		Handler: mux,
+		Addr:    net.JoinHostPort(opts.Bind, strconv.Itoa(port)),
+		Handler: serverHeader(requireAuth(mux, opts), opts),
 	}
+	return s
+}
+
+// shutdown stops the server, on a signal or /api/shutdown: browsers are told
+// first (see notifyShutdown), and the lock file and --socket are removed so
+// the next livemd start doesn't take them for a running daemon.
+func (s *Server) shutdown() {
+	s.notifyShutdown()
+	s.hub.Close()
+	removeLockFile()
+	if s.opts.Socket != "" {
+		os.Remove(s.opts.Socket)
+	}
+	s.server.Shutdown(context.Background())
+}
+
+func StartServer(port int, opts *ServerOptions) {
+	s := newServer(port, opts)
+	hub := s.hub
 
 	// Check for updates in background on startup
 	go func() {
@@ -978,7 +2441,7 @@ func StartServer(port int) {
 		if Version != "dev" {
 			info := CheckForUpdate()
 			if info.UpdateAvail {
-				hub.logger.Info(fmt.Sprintf("Update available: %s (current: %s)", info.Latest, info.Current))
+				hub.logger.Info("Update available", "latest", info.Latest, "current", info.Current)
 			}
 		}
 	}()
@@ -990,12 +2453,45 @@ func StartServer(port int) {
 	go func() {
 		<-sigChan
 		fmt.Println("\nShutting down...")
-		hub.Close()
-		removeLockFile()
-		s.server.Shutdown(context.Background())
+		s.shutdown()
 	}()
 
-	if err := s.server.ListenAndServe(); err != http.ErrServerClosed {
-		log.Fatalf("Server error: %v", err)
+	if opts.TLSSelfSigned {
+		cert, err := selfSignedCertificate()
+		if err != nil {
+			fatal("Could not create --tls-self-signed certificate", "err", err)
+		}
+		s.server.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+		fmt.Println("  Warning: --tls-self-signed certificate is untrusted; browsers will ask you to accept it")
+		fmt.Println()
+	}
+
+	// Listen before serving so --open can't beat the listener to the port.
+	network, addr := "tcp", s.server.Addr
+	if opts.Socket != "" {
+		network, addr = "unix", opts.Socket
+		// Left behind by a daemon that was killed; the lock file said none runs.
+		if info, err := os.Lstat(addr); err == nil && info.Mode()&os.ModeSocket != 0 {
+			os.Remove(addr)
+		}
+	}
+	ln, err := net.Listen(network, addr)
+	if err != nil {
+		fatal("Could not listen", "addr", addr, "err", err)
+	}
+	if opts.OpenBrowser {
+		url := fmt.Sprintf("%s://%s", opts.scheme(), opts.localAddr(port))
+		if err := openBrowser(url); err != nil {
+			hub.logger.Warn("--open: could not open browser", "url", url, "err", err)
+		}
+	}
+	if opts.scheme() == "https" {
+		// Empty file names use TLSConfig's certificate (--tls-self-signed).
+		err = s.server.ServeTLS(ln, opts.TLSCert, opts.TLSKey)
+	} else {
+		err = s.server.Serve(ln)
+	}
+	if err != http.ErrServerClosed {
+		fatal("Server error", "err", err)
 	}
 }
@@ -0,0 +1,379 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// newTestServer returns a Server around a running hub, with its state file
+// in a temporary HOME.
+func newTestServer(t *testing.T, opts *ServerOptions) *Server {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	hub := NewHub(opts)
+	ctx, cancel := context.WithCancel(context.Background())
+	go hub.RunWithContext(ctx)
+	t.Cleanup(func() {
+		cancel()
+		<-hub.stopped
+		hub.Close()
+	})
+	return &Server{hub: hub, opts: opts, stopHub: cancel}
+}
+
+// testOptions are the defaults main gives ServerOptions, for newServer.
+func testOptions() *ServerOptions {
+	return &ServerOptions{
+		ClientTimeout: 60 * time.Second,
+		PingInterval:  defaultPingInterval,
+		ServerName:    "live-md",
+		WSPath:        defaultWSPath,
+		StaticPath:    defaultStaticPath,
+	}
+}
+
+// startTestServer serves newServer's routes on a local port, with its state
+// file in a temporary HOME.
+func startTestServer(t *testing.T, opts *ServerOptions) (*Server, *httptest.Server) {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	s := newServer(0, opts)
+	ts := httptest.NewServer(s.server.Handler)
+	t.Cleanup(func() {
+		ts.Close()
+		s.stopHub()
+		<-s.hub.stopped
+		s.hub.Close()
+	})
+	return s, ts
+}
+
+// waitFor polls cond until it holds or timeout passes.
+func waitFor(timeout time.Duration, cond func() bool) bool {
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return true
+}
+
+func TestSilentWebSocketClientIsDropped(t *testing.T) {
+	opts := &ServerOptions{ClientTimeout: 200 * time.Millisecond, PingInterval: 100 * time.Millisecond}
+	s := newTestServer(t, opts)
+	ts := httptest.NewServer(http.HandlerFunc(s.handleWebSocket))
+	defer ts.Close()
+
+	// A client that never reads never answers a ping.
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if !waitFor(time.Second, func() bool { return s.hub.ClientCount() == 1 }) {
+		t.Fatal("client never registered")
+	}
+	start := time.Now()
+	limit := opts.PingInterval + opts.ClientTimeout
+	if !waitFor(limit+500*time.Millisecond, func() bool { return s.hub.ClientCount() == 0 }) {
+		t.Fatalf("silent client still connected after %s", time.Since(start))
+	}
+}
+
+func TestPingPeriodIsPositive(t *testing.T) {
+	tests := []struct {
+		interval, timeout, want time.Duration
+	}{
+		{30 * time.Second, time.Minute, 30 * time.Second},
+		{time.Minute, 10 * time.Second, 9 * time.Second},
+		{30 * time.Second, time.Nanosecond, time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := pingPeriod(tt.interval, tt.timeout); got != tt.want {
+			t.Errorf("pingPeriod(%s, %s) = %s, want %s", tt.interval, tt.timeout, got, tt.want)
+		}
+	}
+}
+
+func TestIdenticalUpdatesBroadcastOnce(t *testing.T) {
+	s := newTestServer(t, testOptions())
+	path := filepath.Join(t.TempDir(), "doc.md")
+	writeFile(t, path, "# One\n")
+	if err := s.hub.AddFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each save gets a later mtime, as refreshFile skips files that didn't
+	// change on disk.
+	mtime := time.Now()
+	save := func(content string) {
+		writeFile(t, path, content)
+		mtime = mtime.Add(time.Second)
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+		s.hub.refreshFile(path)
+	}
+	save("# Two\n")
+	save("# Two\n")
+	if got := s.hub.messagesBroadcast.Load(); got != 1 {
+		t.Errorf("two identical saves broadcast %d updates, want 1", got)
+	}
+	save("# Three\n")
+	if got := s.hub.messagesBroadcast.Load(); got != 2 {
+		t.Errorf("a changed save: %d updates in all, want 2", got)
+	}
+
+	s.hub.mu.RLock()
+	f := s.hub.files[path]
+	if f.hash != contentHash([]byte(f.HTML)) {
+		t.Errorf("file hash %q isn't the Message.Hash of its HTML", f.hash)
+	}
+	s.hub.mu.RUnlock()
+}
+
+func TestShutdownGraceKeepsBrowsersConnected(t *testing.T) {
+	opts := testOptions()
+	opts.ShutdownGrace = 300 * time.Millisecond
+	s, ts := startTestServer(t, opts)
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+opts.WSPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if !waitFor(time.Second, func() bool { return s.hub.ClientCount() == 1 }) {
+		t.Fatal("client never registered")
+	}
+
+	go s.notifyShutdown()
+	var told time.Time
+	for told.IsZero() {
+		var msg Message
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatalf("connection closed before the shutdown message: %v", err)
+		}
+		if msg.Type == "shutdown" {
+			told = time.Now()
+		}
+	}
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			break
+		}
+	}
+	if held := time.Since(told); held < opts.ShutdownGrace-50*time.Millisecond {
+		t.Errorf("connection closed %s after the shutdown message, want about --shutdown-grace (%s)", held, opts.ShutdownGrace)
+	}
+}
+
+func TestWordCountWarningStaysOnFile(t *testing.T) {
+	opts := testOptions()
+	opts.WordCountThreshold = 3
+	s := newTestServer(t, opts)
+	path := filepath.Join(t.TempDir(), "doc.md")
+	writeFile(t, path, "one two three four\n")
+	if err := s.hub.AddFile(path); err != nil {
+		t.Fatal(err)
+	}
+	// Activating an already active file changes nothing, so a browser that
+	// connects now only learns of the warning from the file list.
+	if err := s.hub.ActivateFile(path); err != nil {
+		t.Fatal(err)
+	}
+	want := "Document exceeds 3 words (current: 4)"
+	if files := s.hub.GetFiles(); len(files) != 1 || files[0].Warning != want {
+		t.Fatalf("file list = %+v, want one file warning %q", files, want)
+	}
+
+	writeFile(t, path, "one two\n")
+	if err := os.Chtimes(path, time.Now().Add(time.Second), time.Now().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	s.hub.refreshFile(path)
+	if files := s.hub.GetFiles(); files[0].Warning != "" {
+		t.Errorf("warning %q kept after the file went under the limit", files[0].Warning)
+	}
+}
+
+func TestAPIContentETag(t *testing.T) {
+	opts := testOptions()
+	opts.LastModifiedHeader = true
+	s, ts := startTestServer(t, opts)
+	path := filepath.Join(t.TempDir(), "doc.md")
+	writeFile(t, path, "# Doc\n")
+	if err := s.hub.AddFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(etag string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+"/api/content?path="+path, nil)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+	resp := get("")
+	etag := resp.Header.Get("ETag")
+	if resp.StatusCode != http.StatusOK || etag == "" {
+		t.Fatalf("first GET: %s with ETag %q", resp.Status, etag)
+	}
+	if resp := get(etag); resp.StatusCode != http.StatusNotModified {
+		t.Errorf("GET with a matching If-None-Match: %s, want 304", resp.Status)
+	}
+	if resp := get(`"stale"`); resp.StatusCode != http.StatusOK {
+		t.Errorf("GET with a stale If-None-Match: %s, want 200", resp.Status)
+	}
+
+	modified := resp.Header.Get("Last-Modified")
+	if modified == "" {
+		t.Fatal("no Last-Modified header")
+	}
+	getSince := func(since string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+"/api/content?path="+path, nil)
+		req.Header.Set("If-Modified-Since", since)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+	if resp := getSince(modified); resp.StatusCode != http.StatusNotModified {
+		t.Errorf("GET with If-Modified-Since the Last-Modified date: %s, want 304", resp.Status)
+	}
+	earlier := time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)
+	if resp := getSince(earlier); resp.StatusCode != http.StatusOK {
+		t.Errorf("GET with an earlier If-Modified-Since: %s, want 200", resp.Status)
+	}
+}
+
+func TestPing(t *testing.T) {
+	s := &Server{}
+	w := httptest.NewRecorder()
+	s.handlePing(w, httptest.NewRequest(http.MethodGet, "/ping", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("status = %d, want 200", w.Code)
+	}
+	if got := w.Body.String(); got != "pong\n" {
+		t.Errorf("body = %q, want %q", got, "pong\n")
+	}
+	if got := w.Header().Get("Content-Type"); got != "text/plain" {
+		t.Errorf("Content-Type = %q, want text/plain", got)
+	}
+
+	w = httptest.NewRecorder()
+	s.handlePing(w, httptest.NewRequest(http.MethodPost, "/ping", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST status = %d, want 405", w.Code)
+	}
+}
+
+// countingConn counts the bytes read from a connection.
+type countingConn struct {
+	net.Conn
+	read *atomic.Int64
+}
+
+func (c countingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.read.Add(int64(n))
+	return n, err
+}
+
+// BenchmarkWebSocketCompression sends this README, rendered, as an update
+// message with and without permessage-deflate, and reports the bytes each
+// message takes on the wire next to its size.
+func BenchmarkWebSocketCompression(b *testing.B) {
+	content, err := os.ReadFile("README.md")
+	if err != nil {
+		b.Fatal(err)
+	}
+	html, err := NewRenderer().renderMarkdown(content)
+	if err != nil {
+		b.Fatal(err)
+	}
+	msg, _ := json.Marshal(Message{Type: "update", File: &WatchedFile{Path: "README.md", HTML: html}})
+	// gorilla/websocket logs a harmless error for every compressed message
+	// a client reads.
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	for _, compress := range []bool{false, true} {
+		name := "uncompressed"
+		if compress {
+			name = "compressed"
+		}
+		b.Run(name, func(b *testing.B) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				up := upgrader
+				up.EnableCompression = compress
+				conn, err := up.Upgrade(w, r, nil)
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+				conn.EnableWriteCompression(compress)
+				// Wait for the client, so the first message isn't read
+				// along with the handshake.
+				if _, _, err := conn.ReadMessage(); err != nil {
+					return
+				}
+				for i := 0; i < b.N; i++ {
+					if conn.WriteMessage(websocket.TextMessage, msg) != nil {
+						return
+					}
+				}
+			}))
+			defer ts.Close()
+
+			var read atomic.Int64
+			dialer := websocket.Dialer{
+				EnableCompression: true, // as browsers do
+				NetDialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+					conn, err := (&net.Dialer{}).DialContext(ctx, network, addr)
+					return countingConn{conn, &read}, err
+				},
+			}
+			conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http"), nil)
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer conn.Close()
+
+			b.ResetTimer()
+			read.Store(0)
+			if err := conn.WriteMessage(websocket.TextMessage, []byte("go")); err != nil {
+				b.Fatal(err)
+			}
+			for i := 0; i < b.N; i++ {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(len(msg)), "payload-B/msg")
+			b.ReportMetric(float64(read.Load())/float64(b.N), "wire-B/msg")
+		})
+	}
+}
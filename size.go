@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// defaultMaxFileSize is the largest file rendered unless --max-size says
+// otherwise.
+const defaultMaxFileSize = 10 << 20
+
+// byteUnits are the suffixes parseBytes accepts, largest first so "MB"
+// isn't taken for "B". KB is 1024 bytes, as in most file managers.
+var byteUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"TB", 1 << 40},
+	{"GB", 1 << 30},
+	{"MB", 1 << 20},
+	{"KB", 1 << 10},
+	{"B", 1},
+}
+
+// parseBytes parses a size such as "10MB", "1.5 GB", "512kb" or "4096" (in
+// bytes). KiB, MiB, ... and the bare K, M, G, T mean the same as KB, MB, ...
+func parseBytes(s string) (int64, error) {
+	spec := strings.ToUpper(strings.TrimSpace(s))
+	spec = strings.Replace(spec, "IB", "B", 1)
+	if n := len(spec); n > 0 && strings.ContainsRune("KMGT", rune(spec[n-1])) {
+		spec += "B"
+	}
+	multiplier := int64(1)
+	for _, unit := range byteUnits {
+		if strings.HasSuffix(spec, unit.suffix) {
+			spec, multiplier = strings.TrimSpace(strings.TrimSuffix(spec, unit.suffix)), unit.size
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(spec, 64)
+	if err != nil || n != n || n < 0 || n*float64(multiplier) > float64(1<<62) { // n != n: NaN
+		return 0, fmt.Errorf("invalid size %q (use e.g. 500KB, 10MB or 1GB)", s)
+	}
+	return int64(n * float64(multiplier)), nil
+}
+
+// formatBytes writes n in the largest unit it reaches, e.g. "12.5 MB".
+func formatBytes(n int64) string {
+	for _, unit := range byteUnits {
+		if n >= unit.size && unit.size > 1 {
+			value := strconv.FormatFloat(float64(n)/float64(unit.size), 'f', 1, 64)
+			return strings.TrimSuffix(value, ".0") + " " + unit.suffix
+		}
+	}
+	return strconv.FormatInt(n, 10) + " B"
+}
@@ -0,0 +1,72 @@
+package main
+
+import "testing"
+
+func TestParseBytes(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{"4096", 4096, false},
+		{"0", 0, false},
+		{"1B", 1, false},
+		{"512kb", 512 << 10, false},
+		{"10MB", 10 << 20, false},
+		{"1GB", 1 << 30, false},
+		{"2TB", 2 << 40, false},
+		{"1.5 GB", 3 << 29, false},
+		{"  10 MB  ", 10 << 20, false},
+		{"1KiB", 1 << 10, false},
+		{"4 MiB", 4 << 20, false},
+		{"1gib", 1 << 30, false},
+		{"2K", 2 << 10, false},
+		{"3m", 3 << 20, false},
+		{"1 G", 1 << 30, false},
+
+		{"", 0, true},
+		{"   ", 0, true},
+		{"MB", 0, true},
+		{"ten MB", 0, true},
+		{"10 XB", 0, true},
+		{"-1", 0, true},
+		{"-5MB", 0, true},
+		{"NaN", 0, true},
+		{"nan MB", 0, true},
+		{"Inf", 0, true},
+		{"+Inf KB", 0, true},
+		{"-Inf", 0, true},
+		{"99999999TB", 0, true},
+		{"1e300", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseBytes(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseBytes(%q) = %d, want an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("parseBytes(%q) = %d, %v; want %d", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		in   int64
+		want string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1 << 10, "1 KB"},
+		{10 << 20, "10 MB"},
+		{25 << 19, "12.5 MB"},
+	}
+	for _, tt := range tests {
+		if got := formatBytes(tt.in); got != tt.want {
+			t.Errorf("formatBytes(%d) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// handleEvents is the Server-Sent Events fallback for browsers whose proxy
+// won't upgrade to WebSocket. The client is registered with the hub like a
+// WebSocket one, so it gets the same JSON messages, one per "data:" line;
+// only its cursor can't be shared, as the stream is one-way.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	client := &Client{
+		hub:       s.hub,
+		send:      make(chan []byte, 256),
+		addr:      r.RemoteAddr,
+		connected: time.Now(),
+		path:      r.URL.Query().Get("path"),
+		id:        newClientID(),
+	}
+	if !s.hub.join(client) {
+		http.Error(w, "Server is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	// The hub answers with the file list, or refuses the client
+	// (--connection-limit-per-ip) with an error. A refusal becomes a 429
+	// before the stream starts, which EventSource doesn't retry.
+	first, ok := <-client.send
+	if !ok {
+		http.Error(w, "Server is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	var answer Message
+	if json.Unmarshal(first, &answer) == nil && answer.Type == "error" {
+		http.Error(w, answer.Error, http.StatusTooManyRequests)
+		return
+	}
+	defer s.hub.leave(client)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // nginx would hold events back
+	w.WriteHeader(http.StatusOK)
+	if _, err := fmt.Fprintf(w, "data: %s\n\n", first); err != nil {
+		return
+	}
+	flusher.Flush()
+
+	// Comment lines keep proxies from timing out an idle stream.
+	ticker := time.NewTicker(s.opts.PingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case message, ok := <-client.send:
+			if !ok {
+				return
+			}
+			if _, err := fmt.Fprintf(w, "data: %s\n\n", message); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-ticker.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readEvent returns the next "data:" message of an event stream.
+func readEvent(t *testing.T, events *bufio.Reader) Message {
+	t.Helper()
+	for {
+		line, err := events.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading the event stream: %v", err)
+		}
+		data, ok := strings.CutPrefix(strings.TrimRight(line, "\n"), "data: ")
+		if !ok {
+			continue // blank separator or ": ping" comment
+		}
+		var msg Message
+		if err := json.Unmarshal([]byte(data), &msg); err != nil {
+			t.Fatalf("bad event %q: %v", data, err)
+		}
+		return msg
+	}
+}
+
+func TestEventsSendContentThenUpdates(t *testing.T) {
+	s, ts := startTestServer(t, testOptions())
+	path := filepath.Join(t.TempDir(), "doc.md")
+	writeFile(t, path, "# Before\n")
+	if err := s.hub.AddFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.Get(ts.URL + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("GET /events: %s %s", resp.Status, resp.Header.Get("Content-Type"))
+	}
+	events := bufio.NewReader(resp.Body)
+
+	msg := readEvent(t, events)
+	if msg.Type != "files" || len(msg.Files) != 1 || !strings.Contains(msg.Files[0].HTML, "Before") {
+		t.Fatalf("first event = %+v, want the file list with the content", msg)
+	}
+
+	writeFile(t, path, "# After\n")
+	later := time.Now().Add(time.Second)
+	os.Chtimes(path, later, later)
+	s.hub.refreshFile(path)
+	for {
+		msg = readEvent(t, events)
+		if msg.Type == "update" {
+			break
+		}
+	}
+	if msg.File == nil || !strings.Contains(msg.File.HTML, "After") || msg.Hash != contentHash([]byte(msg.File.HTML)) {
+		t.Errorf("update event = %+v, want the new content", msg)
+	}
+}
+
+func TestEventsRefuseClientsOverLimitUpFront(t *testing.T) {
+	opts := testOptions()
+	opts.ConnectionLimitPerIP = 1
+	_, ts := startTestServer(t, opts)
+
+	first, err := http.Get(ts.URL + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Body.Close()
+	if first.StatusCode != http.StatusOK {
+		t.Fatalf("first GET /events: %s", first.Status)
+	}
+	readEvent(t, bufio.NewReader(first.Body)) // registered by now
+
+	second, err := http.Get(ts.URL + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second.Body.Close()
+	if second.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("second GET /events: %s, want 429 so EventSource stops retrying", second.Status)
+	}
+}
@@ -42,8 +42,25 @@
         return katexPromise;
     }
 
+    // morphdom backs the "patch" reload strategy; loaded on first use.
+    let morphdomPromise = null;
+    function loadMorphdom() {
+        if (morphdomPromise) return morphdomPromise;
+        morphdomPromise = new Promise((resolve, reject) => {
+            const s = document.createElement('script');
+            s.src = 'https://cdn.jsdelivr.net/npm/morphdom@2.7.4/dist/morphdom-umd.min.js';
+            s.onload = () => resolve(window.morphdom);
+            s.onerror = reject;
+            document.head.appendChild(s);
+        });
+        return morphdomPromise;
+    }
+
     function enhanceContent(root) {
         if (!root) return;
+        // Task list checkboxes toggle the markdown source (see the change
+        // listener on #content); goldmark renders them disabled.
+        taskBoxes(root).forEach(box => box.removeAttribute('disabled'));
         // Mermaid: server emits <div class="mermaid">...</div>; reset processed
         // attributes so re-renders work after live updates.
         const mermaidNodes = root.querySelectorAll('.mermaid');
@@ -51,6 +68,24 @@
             mermaidNodes.forEach(n => n.removeAttribute('data-processed'));
             loadMermaid().then(m => m.run({ nodes: mermaidNodes })).catch(() => {});
         }
+        // --math: the server has already found the math; typeset just that.
+        if (serverMath) {
+            const mathNodes = root.querySelectorAll('.math-inline, .math-display');
+            if (mathNodes.length) {
+                loadKatex().then(() => {
+                    mathNodes.forEach(n => {
+                        // Keep the LaTeX: n.textContent is KaTeX's output once typeset.
+                        const tex = n.dataset.tex || n.textContent;
+                        n.dataset.tex = tex;
+                        window.katex.render(tex, n, {
+                            displayMode: n.classList.contains('math-display'),
+                            throwOnError: false,
+                        });
+                    });
+                }).catch(() => {});
+            }
+            return;
+        }
         // Math: only load KaTeX if a $ appears in the content (cheap heuristic).
         if (root.textContent && root.textContent.indexOf('$') !== -1) {
             loadKatex().then(render => {
@@ -77,19 +112,38 @@
     const checkUpdateBtn = document.getElementById('check-update-btn');
     const updateBanner = document.getElementById('update-banner');
     const updateText = document.getElementById('update-text');
+    const shutdownBanner = document.getElementById('shutdown-banner');
+    const shutdownText = document.getElementById('shutdown-text');
     const versionLabel = document.getElementById('version-label');
     const contentHeaderFilename = document.getElementById('content-header-filename');
     const contentHeaderPath = document.getElementById('content-header-path');
     const contentHeaderChanged = document.getElementById('content-header-changed');
+    const contentHeaderRender = document.getElementById('content-header-render');
+    const contentHeaderBroken = document.getElementById('content-header-broken');
+    const contentHeaderWarning = document.getElementById('content-header-warning');
 
     let ws;
     let reconnectDelay = 1000;
+    let refused = false; // the server turned this connection away
+    let wsWorked = false; // a WebSocket has opened; else fall back to /events
+    const wsPathMeta = document.querySelector('meta[name="livemd-ws-path"]');
+    const wsPath = wsPathMeta ? wsPathMeta.content : '/ws'; // --ws-path
     const maxReconnectDelay = 10000;
 
     let files = [];
     let folders = []; // followed folders (auto-add new files)
     let logs = [];
     let activeFile = null;
+    let reloadStrategy = 'replace'; // set by the server (--reload-strategy)
+    let scrollMarginTop = 0; // set by the server (--scroll-margin)
+    let copyExclude = ''; // set by the server (--highlight-copy-exclude)
+    let serverMath = false; // set by the server (--math)
+    let shownHash = ''; // Message.hash of the HTML in #content, '' = unknown
+    const renderTimes = {}; // path -> milliseconds its last update took to render
+    let liveCursor = false; // set by the server (--live-cursor)
+    let maxCursors = 0; // set by the server (--max-cursors)
+    const cursors = new Map(); // other clients' positions, least recently moved first
+    const cursorTrack = document.getElementById('cursor-track');
 
     function findFollowedFolder(path) {
         // case-insensitive on Windows; assume server already normalized
@@ -118,6 +172,10 @@
         });
     });
 
+    document.getElementById('shutdown-dismiss').addEventListener('click', () => {
+        shutdownBanner.classList.add('is-hidden');
+    });
+
     // Check for updates button
     checkUpdateBtn.addEventListener('click', () => {
         checkUpdateBtn.textContent = 'Checking...';
@@ -518,13 +576,35 @@
             contentHeaderFilename.textContent = file.name;
             contentHeaderPath.textContent = file.path;
             contentHeaderChanged.textContent = file.lastChange ? 'Changed: ' + formatShortDateTime(file.lastChange) : '';
+            const ms = renderTimes[file.path];
+            contentHeaderRender.textContent = ms === undefined ? '' : 'Rendered in ' + (ms || '<1') + ' ms';
+            showBrokenLinks(file.brokenLinks || []);
+            showWarning(file.warning || '');
         } else {
             contentHeaderFilename.textContent = 'No file selected';
             contentHeaderPath.textContent = '';
             contentHeaderChanged.textContent = '';
+            contentHeaderRender.textContent = '';
+            showBrokenLinks([]);
+            showWarning('');
         }
     }
 
+    // showBrokenLinks counts the active file's --check-links findings in the
+    // content header, listing them in its tooltip.
+    function showBrokenLinks(links) {
+        contentHeaderBroken.textContent = links.length === 1 ? '1 broken link' : links.length + ' broken links';
+        contentHeaderBroken.title = 'Broken links:\n' + links.join('\n');
+        contentHeaderBroken.classList.toggle('is-hidden', links.length === 0);
+    }
+
+    // showWarning puts the active file's --word-count-threshold warning, if
+    // any, in the content header.
+    function showWarning(warning) {
+        contentHeaderWarning.textContent = warning;
+        contentHeaderWarning.classList.toggle('is-hidden', !warning);
+    }
+
     function selectFile(path) {
         const file = files.find(f => f.path === path);
         if (file && file.deleted) return; // Can't select deleted files
@@ -532,11 +612,16 @@
         const previousFile = activeFile;
         activeFile = path;
         renderFileList();
+        showWarning((file && file.warning) || '');
+        renderCursors();
+        sendCursor();
 
+        shownHash = '';
         if (file && file.html) {
             content.innerHTML = file.html;
             enhanceContent(content);
-            document.title = file.name + ' - LiveMD';
+            scrollToHash();
+            document.title = (file.title || file.name) + ' - LiveMD';
             updateContentHeader(file);
         }
 
@@ -549,6 +634,214 @@
         }
     }
 
+    // applyUpdate shows new HTML for the active file per --reload-strategy.
+    function applyUpdate(html) {
+        if (reloadStrategy === 'reload') {
+            // Come back to the same file after the reload.
+            sessionStorage.setItem('livemd.activeFile', activeFile);
+            window.location.reload();
+            return;
+        }
+        const anchor = scrollAnchor();
+        if (reloadStrategy === 'patch') {
+            loadMorphdom().then(morphdom => {
+                const next = content.cloneNode(false);
+                next.innerHTML = html;
+                morphdom(content, next, { childrenOnly: true });
+                enhanceContent(content);
+                restoreScroll(anchor);
+            }).catch(() => {
+                content.innerHTML = html;
+                enhanceContent(content);
+                restoreScroll(anchor);
+            });
+            return;
+        }
+        content.innerHTML = html;
+        enhanceContent(content);
+        restoreScroll(anchor);
+    }
+
+    // scrollAnchor records where the reader is: the scroll offset of the
+    // content pane, and the last heading above its top with that heading's
+    // distance from it. Edits above the heading shift the offset, not it.
+    function scrollAnchor() {
+        const anchor = { top: content.scrollTop, id: '', offset: 0 };
+        const paneTop = content.getBoundingClientRect().top;
+        for (const h of content.querySelectorAll('h1[id], h2[id], h3[id], h4[id], h5[id], h6[id]')) {
+            const offset = h.getBoundingClientRect().top - paneTop;
+            if (offset > 0) break;
+            anchor.id = h.id;
+            anchor.offset = offset;
+        }
+        return anchor;
+    }
+
+    // restoreScroll puts the reader back where scrollAnchor found them after
+    // the content was replaced: relative to the same heading if it still
+    // exists, else at the same offset.
+    function restoreScroll(anchor) {
+        const heading = anchor.id && document.getElementById(anchor.id);
+        if (heading && content.contains(heading)) {
+            content.scrollTop += heading.getBoundingClientRect().top - content.getBoundingClientRect().top - anchor.offset;
+        } else {
+            content.scrollTop = anchor.top;
+        }
+    }
+
+    // scrollToHash brings the heading named by the URL fragment into view,
+    // so links like http://localhost:3000/#installation survive re-renders.
+    function scrollToHash() {
+        if (!window.location.hash) return;
+        let id;
+        try {
+            id = decodeURIComponent(window.location.hash.slice(1));
+        } catch (e) {
+            return;
+        }
+        const target = document.getElementById(id);
+        if (target && content.contains(target)) {
+            scrollToElement(target);
+        }
+    }
+
+    // scrollToElement scrolls a heading into view below any sticky header,
+    // whose height the server sends as --scroll-margin.
+    function scrollToElement(el) {
+        el.scrollIntoView();
+        if (scrollMarginTop) {
+            content.scrollBy(0, -scrollMarginTop);
+        }
+    }
+
+    // In-page links (tables of contents, section links) honor the margin too.
+    content.addEventListener('click', e => {
+        const link = e.target.closest('a[href^="#"]');
+        if (!link || !content.contains(link)) return;
+        let target;
+        try {
+            target = document.getElementById(decodeURIComponent(link.getAttribute('href').slice(1)));
+        } catch (err) {
+            return;
+        }
+        if (!target || !content.contains(target)) return;
+        e.preventDefault();
+        history.pushState(null, '', link.getAttribute('href'));
+        scrollToElement(target);
+    });
+
+    // taskBoxes are the task list checkboxes of the rendered markdown, in
+    // document order, which is how /api/toggle-task numbers them.
+    function taskBoxes(root) {
+        return root.querySelectorAll('li > input[type="checkbox"], li > p:first-child > input[type="checkbox"]');
+    }
+
+    // Ticking a task list item writes [x] (or [ ]) into the file; the
+    // re-render that follows shows the new state to every browser.
+    content.addEventListener('change', e => {
+        const box = e.target;
+        const index = Array.prototype.indexOf.call(taskBoxes(content), box);
+        if (index < 0 || !activeFile) return;
+        box.disabled = true;
+        fetch('/api/toggle-task', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ path: activeFile, index, checked: box.checked, hash: shownHash }),
+        }).then(res => {
+            if (!res.ok) return res.text().then(text => { throw new Error(text.trim()); });
+        }).catch(err => {
+            console.error('Failed to toggle task:', err);
+            box.checked = !box.checked;
+        }).finally(() => {
+            box.disabled = false;
+        });
+    });
+
+    // trackHeading keeps the URL fragment on the last heading scrolled past,
+    // making the address bar a shareable link to the current section.
+    let headingFrame = 0;
+    function trackHeading() {
+        if (headingFrame) return;
+        headingFrame = requestAnimationFrame(() => {
+            headingFrame = 0;
+            const top = content.getBoundingClientRect().top;
+            let current = null;
+            for (const h of content.querySelectorAll('h1[id], h2[id], h3[id], h4[id], h5[id], h6[id]')) {
+                if (h.getBoundingClientRect().top - top > scrollMarginTop + 8) break;
+                current = h.id;
+            }
+            const hash = current ? '#' + encodeURIComponent(current) : '';
+            if (hash !== window.location.hash) {
+                history.replaceState(null, '', window.location.pathname + window.location.search + hash);
+            }
+        });
+    }
+    content.addEventListener('scroll', trackHeading);
+
+    // --live-cursor: tell the server where this browser is scrolled to, at
+    // most every 100ms, and mark where the others viewing the file are.
+    let cursorTimer = 0;
+    function sendCursor() {
+        if (!liveCursor || !activeFile || cursorTimer) return;
+        cursorTimer = setTimeout(() => {
+            cursorTimer = 0;
+            if (!ws || ws.readyState !== WebSocket.OPEN) return;
+            const range = content.scrollHeight - content.clientHeight;
+            const scrollPct = range > 0 ? content.scrollTop / range * 100 : 0;
+            ws.send(JSON.stringify({ type: 'cursor', cursor: { path: activeFile, scrollPct } }));
+        }, 100);
+    }
+    content.addEventListener('scroll', sendCursor);
+
+    // cursorColor gives every client its own hue, the same in every browser.
+    function cursorColor(id) {
+        let hash = 0;
+        for (const ch of id) hash = (hash * 31 + ch.charCodeAt(0)) | 0;
+        return `hsl(${Math.abs(hash) % 360}, 70%, 50%)`;
+    }
+
+    function renderCursors() {
+        cursorTrack.innerHTML = '';
+        cursorTrack.style.top = content.offsetTop + 'px';
+        let shown = [...cursors.values()].filter(c => c.path === activeFile);
+        if (maxCursors > 0) shown = shown.slice(-maxCursors);
+        for (const c of shown) {
+            const marker = document.createElement('div');
+            marker.className = 'cursor-marker';
+            marker.style.top = `calc(${c.scrollPct}% - ${c.scrollPct * 0.06}px)`; // stays inside the track
+            marker.style.background = cursorColor(c.clientID);
+            marker.title = 'Another viewer';
+            cursorTrack.appendChild(marker);
+        }
+    }
+
+    // Copying from a code block leaves out the elements matching
+    // --highlight-copy-exclude, such as shell prompts. The selector is matched
+    // in the live block, so it can refer to the block itself (.chroma .gp).
+    content.addEventListener('copy', e => {
+        if (!copyExclude) return;
+        const selection = window.getSelection();
+        if (!selection.rangeCount || selection.isCollapsed) return;
+        const range = selection.getRangeAt(0);
+        let node = range.commonAncestorContainer;
+        if (node.nodeType !== Node.ELEMENT_NODE) node = node.parentElement;
+        const pre = node && node.closest('pre');
+        if (!pre || !content.contains(pre)) return;
+        let excluded;
+        try {
+            excluded = pre.querySelectorAll(copyExclude);
+        } catch (err) {
+            return; // invalid selector: copy as usual
+        }
+        if (!excluded.length) return;
+        excluded.forEach(el => el.setAttribute('data-copy-exclude', ''));
+        const copied = range.cloneContents();
+        excluded.forEach(el => el.removeAttribute('data-copy-exclude'));
+        copied.querySelectorAll('[data-copy-exclude]').forEach(el => el.remove());
+        e.clipboardData.setData('text/plain', copied.textContent);
+        e.preventDefault();
+    });
+
     function activateFile(path) {
         fetch('/api/files/activate?path=' + encodeURIComponent(path), {
             method: 'POST'
@@ -565,108 +858,223 @@
         });
     }
 
+    // handleMessage applies a server message, from the WebSocket or the
+    // /events fallback.
+    // updateFile takes in a new rendering of file, whose HTML hashes to hash,
+    // and shows it if it's the active file.
+    function updateFile(file, hash) {
+        file.hash = hash || '';
+        const idx = files.findIndex(f => f.path === file.path);
+        if (idx >= 0) {
+            files[idx] = file;
+        } else {
+            files.push(file);
+        }
+        renderFileList();
+
+        if (file.path === activeFile) {
+            document.title = (file.title || file.name) + ' - LiveMD';
+            updateContentHeader(file);
+            // A save that didn't change the output (touch, whitespace) leaves the page alone.
+            if (!hash || hash !== shownHash) {
+                applyUpdate(file.html);
+            }
+            shownHash = hash || '';
+        }
+    }
+
+    // applyPatch applies an --incremental patch (see Op in patch.go) to html.
+    function applyPatch(html, patch) {
+        let out = '';
+        let pos = 0;
+        for (const op of patch) {
+            if (op.r) {
+                out += html.slice(pos, pos + op.r);
+                pos += op.r;
+            } else if (op.d) {
+                pos += op.d;
+            } else if (op.i) {
+                out += op.i;
+            }
+        }
+        return out + html.slice(pos);
+    }
+
+    // fetchFile gets the whole rendering of path, for when a patch doesn't
+    // apply to the HTML we have (we connected after it was sent, say).
+    function fetchFile(path) {
+        fetch('/api/content?path=' + encodeURIComponent(path))
+            .then(res => res.ok ? res.json() : Promise.reject(new Error(res.statusText)))
+            .then(msg => { if (msg.file) updateFile(msg.file, msg.hash); })
+            .catch(err => console.error('Failed to fetch file:', err));
+    }
+
+    // --css: fetch the stylesheet again, keeping the document as it is.
+    function reloadCustomCSS() {
+        const link = document.getElementById('livemd-custom-css');
+        if (link) link.href = '/custom.css?v=' + Date.now().toString(36);
+    }
+
+    function handleMessage(event) {
+        const data = JSON.parse(event.data);
+
+        switch (data.type) {
+            case 'files':
+                files = data.files || [];
+                folders = data.folders || [];
+                if (data.config) {
+                    reloadStrategy = data.config.reloadStrategy || 'replace';
+                    scrollMarginTop = data.config.scrollMarginTop || 0;
+                    copyExclude = data.config.copyExclude || '';
+                    liveCursor = !!data.config.liveCursor;
+                    maxCursors = data.config.maxCursors || 0;
+                    serverMath = !!data.config.math;
+                }
+                renderFileList();
+
+                if (!activeFile && files.length > 0) {
+                    const saved = sessionStorage.getItem('livemd.activeFile');
+                    sessionStorage.removeItem('livemd.activeFile');
+                    const restored = files.find(f => f.path === saved && !f.deleted);
+                    const firstNonDeleted = restored || files.find(f => !f.deleted);
+                    if (firstNonDeleted) selectFile(firstNonDeleted.path);
+                } else if (activeFile) {
+                    const file = files.find(f => f.path === activeFile);
+                    if (file && file.html && !file.deleted) {
+                        content.innerHTML = file.html;
+                        enhanceContent(content);
+                        scrollToHash();
+                        updateContentHeader(file);
+                    } else if (file && file.deleted) {
+                        content.innerHTML = `
+                            <div class="welcome">
+                                <h1 class="has-text-danger">File Deleted</h1>
+                                <p>${escapeHtml(file.name)} has been deleted from disk.</p>
+                            </div>
+                        `;
+                        updateContentHeader(null);
+                    }
+                }
+                break;
+
+            case 'logs':
+                logs = data.logs || [];
+                renderLogList();
+                break;
+
+            case 'log':
+                if (data.log) {
+                    logs.push(data.log);
+                    if (logs.length > 100) {
+                        logs = logs.slice(-100);
+                    }
+                    renderLogList();
+                }
+                break;
+
+            case 'update':
+                if (data.file) renderTimes[data.file.path] = data.renderMs || 0;
+                if (data.file && data.patch) {
+                    // --incremental: the HTML comes as a diff against what we were sent last.
+                    const old = files.find(f => f.path === data.file.path);
+                    if (old && old.hash === data.base && typeof old.html === 'string') {
+                        data.file.html = applyPatch(old.html, data.patch);
+                        updateFile(data.file, data.hash);
+                    } else {
+                        fetchFile(data.file.path);
+                    }
+                } else if (data.file) {
+                    updateFile(data.file, data.hash);
+                }
+                break;
+
+            case 'cursor':
+                if (data.cursor) {
+                    cursors.delete(data.cursor.clientID);
+                    if (!data.cursor.gone) cursors.set(data.cursor.clientID, data.cursor);
+                    renderCursors();
+                }
+                break;
+
+            case 'select':
+                // --watch-create-only: jump to the newest file.
+                if (data.path && data.path !== activeFile) {
+                    selectFile(data.path);
+                }
+                break;
+
+            case 'error':
+                // --connection-limit-per-ip: the server hangs up next.
+                refused = true;
+                status.textContent = 'refused';
+                status.className = 'tag is-danger is-light';
+                status.title = data.error || '';
+                break;
+
+            case 'shutdown':
+                // The server closes the connection after --shutdown-grace.
+                shutdownText.textContent = data.error || 'Server is shutting down';
+                shutdownBanner.classList.remove('is-hidden');
+                break;
+
+            case 'reload':
+                if (data.reload === 'page') {
+                    window.location.reload();
+                } else if (data.reload === 'css') {
+                    reloadCustomCSS();
+                }
+                break;
+
+            case 'removed':
+                files = files.filter(f => f.path !== data.path);
+                renderFileList();
+
+                if (data.path === activeFile) {
+                    activeFile = null;
+                    const remaining = files.filter(f => !f.deleted);
+                    if (remaining.length > 0) {
+                        selectFile(remaining[0].path);
+                    } else {
+                        content.innerHTML = `
+                            <div class="welcome">
+                                <h1>LiveMD</h1>
+                                <p>Add a markdown file to get started:</p>
+                                <pre><code>livemd add README.md</code></pre>
+                            </div>
+                        `;
+                        document.title = 'LiveMD';
+                        updateContentHeader(null);
+                    }
+                }
+                break;
+        }
+    }
+
     function connect() {
         const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
-        ws = new WebSocket(`${protocol}//${window.location.host}/ws`);
+        ws = new WebSocket(`${protocol}//${window.location.host}${wsPath}`);
 
         ws.onopen = function() {
+            wsWorked = true;
             status.textContent = 'live';
             status.className = 'tag is-success is-light';
+            shutdownBanner.classList.add('is-hidden'); // back up again
             reconnectDelay = 1000;
             // Check version on connect
             checkForUpdates();
         };
 
-        ws.onmessage = function(event) {
-            const data = JSON.parse(event.data);
-
-            switch (data.type) {
-                case 'files':
-                    files = data.files || [];
-                    folders = data.folders || [];
-                    renderFileList();
-
-                    if (!activeFile && files.length > 0) {
-                        const firstNonDeleted = files.find(f => !f.deleted);
-                        if (firstNonDeleted) selectFile(firstNonDeleted.path);
-                    } else if (activeFile) {
-                        const file = files.find(f => f.path === activeFile);
-                        if (file && file.html && !file.deleted) {
-                            content.innerHTML = file.html;
-                            enhanceContent(content);
-                            updateContentHeader(file);
-                        } else if (file && file.deleted) {
-                            content.innerHTML = `
-                                <div class="welcome">
-                                    <h1 class="has-text-danger">File Deleted</h1>
-                                    <p>${escapeHtml(file.name)} has been deleted from disk.</p>
-                                </div>
-                            `;
-                            updateContentHeader(null);
-                        }
-                    }
-                    break;
-
-                case 'logs':
-                    logs = data.logs || [];
-                    renderLogList();
-                    break;
-
-                case 'log':
-                    if (data.log) {
-                        logs.push(data.log);
-                        if (logs.length > 100) {
-                            logs = logs.slice(-100);
-                        }
-                        renderLogList();
-                    }
-                    break;
-
-                case 'update':
-                    if (data.file) {
-                        const idx = files.findIndex(f => f.path === data.file.path);
-                        if (idx >= 0) {
-                            files[idx] = data.file;
-                        } else {
-                            files.push(data.file);
-                        }
-                        renderFileList();
-
-                        if (data.file.path === activeFile) {
-                            const scrollY = window.scrollY;
-                            content.innerHTML = data.file.html;
-                            enhanceContent(content);
-                            window.scrollTo(0, scrollY);
-                        }
-                    }
-                    break;
-
-                case 'removed':
-                    files = files.filter(f => f.path !== data.path);
-                    renderFileList();
-
-                    if (data.path === activeFile) {
-                        activeFile = null;
-                        const remaining = files.filter(f => !f.deleted);
-                        if (remaining.length > 0) {
-                            selectFile(remaining[0].path);
-                        } else {
-                            content.innerHTML = `
-                                <div class="welcome">
-                                    <h1>LiveMD</h1>
-                                    <p>Add a markdown file to get started:</p>
-                                    <pre><code>livemd add README.md</code></pre>
-                                </div>
-                            `;
-                            document.title = 'LiveMD';
-                            updateContentHeader(null);
-                        }
-                    }
-                    break;
-            }
-        };
+        ws.onmessage = handleMessage;
 
         ws.onclose = function() {
+            cursors.clear(); // resent by the server on reconnect
+            renderCursors();
+            if (refused) return; // reconnecting would be refused again
+            if (!wsWorked && window.EventSource) {
+                // Never got through: likely a proxy that blocks WebSocket.
+                connectEvents();
+                return;
+            }
             status.textContent = 'disconnected';
             status.className = 'tag is-danger is-light';
 
@@ -682,6 +1090,30 @@
         };
     }
 
+    // connectEvents receives updates over Server-Sent Events instead. The
+    // stream is one-way, so this browser's cursor isn't shared; EventSource
+    // reconnects by itself.
+    function connectEvents() {
+        const events = new EventSource('/events');
+        events.onopen = function() {
+            status.textContent = 'live';
+            status.title = 'Server-Sent Events (WebSocket unavailable)';
+            status.className = 'tag is-success is-light';
+            checkForUpdates();
+        };
+        events.onmessage = handleMessage;
+        events.onerror = function() {
+            cursors.clear(); // resent by the server on reconnect
+            renderCursors();
+            if (refused) {
+                events.close(); // reconnecting would be refused again
+                return;
+            }
+            status.textContent = 'disconnected';
+            status.className = 'tag is-danger is-light';
+        };
+    }
+
     // Sidebar resizer
     const sidebar = document.querySelector('.sidebar');
     const resizer = document.getElementById('sidebar-resizer');
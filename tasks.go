@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// taskMarker matches the start of a GFM task list item up to its box,
+// "- [ ] " or "1. [x] ", possibly inside block quotes. Group 2 is the
+// character between the brackets.
+var taskMarker = regexp.MustCompile(`^((?:\s*>)*\s*(?:[-*+]|\d{1,9}[.)])\s+\[)([ xX])\]\s`)
+
+// errNoTask is returned when the document has fewer task list items than
+// the index asked for, or the line found no longer holds one.
+var errNoTask = errors.New("no such task list item")
+
+// taskSource finds the file and 0-based line of the index'th task list item
+// of the markdown file at path, counting from 0 the way the rendered
+// document numbers its checkboxes: through the files it includes, and
+// skipping front matter and fenced code blocks.
+func (r *Renderer) taskSource(path string, index int) (string, int, error) {
+	content, err := r.readText(path)
+	if err != nil {
+		return "", 0, err
+	}
+	front, body := splitFrontMatter(content)
+	e := &includeExpander{read: r.readText, maxDepth: r.includeMax, included: make(map[string]bool), trackLines: true}
+	abs, _ := filepath.Abs(path)
+	expanded := e.expand(abs, body, frontMatterLines(front), []string{abs})
+	line, err := findTask(bytes.SplitAfter(expanded, []byte("\n")), index)
+	if err != nil {
+		return "", 0, err
+	}
+	if line >= len(e.origins) || e.origins[line].path == "" {
+		return "", 0, errNoTask
+	}
+	return e.origins[line].path, e.origins[line].line, nil
+}
+
+// findTask returns which of lines holds the index'th task list item,
+// counting from 0. Items inside fenced code blocks don't count, just as they
+// don't render as checkboxes.
+func findTask(lines [][]byte, index int) (int, error) {
+	fence := ""
+	n := 0
+	for i, line := range lines {
+		trimmed := strings.TrimLeft(string(line), " \t>")
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+			continue
+		}
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fence = trimmed[:3]
+			continue
+		}
+		if !taskMarker.Match(line) {
+			continue
+		}
+		if n++; n > index {
+			return i, nil
+		}
+	}
+	return 0, errNoTask
+}
+
+// setTask checks (or with checked false, unchecks) the task list item on
+// the given 0-based line of content and returns the new content.
+func setTask(content []byte, line int, checked bool) ([]byte, error) {
+	lines := bytes.SplitAfter(append([]byte(nil), content...), []byte("\n"))
+	if line < 0 || line >= len(lines) {
+		return nil, errNoTask
+	}
+	m := taskMarker.FindSubmatchIndex(lines[line])
+	if m == nil {
+		return nil, errNoTask
+	}
+	if (lines[line][m[4]] != ' ') == checked {
+		return content, nil // already in that state, e.g. another browser got there first
+	}
+	box := byte(' ')
+	if checked {
+		box = 'x'
+	}
+	lines[line][m[4]] = box
+	return bytes.Join(lines, nil), nil
+}
+
+// writeFileAtomic replaces the file at path with data through a temporary
+// file in the same directory, so the watcher never sees it half written. The
+// file keeps its permissions.
+func writeFileAtomic(path string, data []byte) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(info.Mode().Perm()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// handleToggleTask is POST /api/toggle-task: it checks or unchecks a task list
+// checkbox in the markdown source of a watched file, or of the file it
+// includes the item from, and the watcher then re-renders it for every
+// browser. The body names the file, the item's index
+// among the document's checkboxes and the state wanted, plus optionally the
+// Message.Hash of the HTML the click was made in; if the file has been
+// re-rendered since, the index may be stale and the request fails with 409.
+// Toggles are serialized, so two browsers clicking at once can't lose a write.
+func (s *Server) handleToggleTask(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		Path    string `json:"path"`
+		Index   int    `json:"index"`
+		Checked bool   `json:"checked"`
+		Hash    string `json:"hash"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Index < 0 {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	s.taskMu.Lock()
+	defer s.taskMu.Unlock()
+
+	s.hub.mu.RLock()
+	var path, shown string
+	for k, f := range s.hub.files {
+		if PathsEqual(k, req.Path) {
+			path, shown = k, f.hash
+			break
+		}
+	}
+	s.hub.mu.RUnlock()
+	if path == "" || !isMarkdown(path) {
+		http.NotFound(w, r)
+		return
+	}
+	if req.Hash != "" && req.Hash != shown {
+		http.Error(w, "Document changed, reload it and try again", http.StatusConflict)
+		return
+	}
+
+	file, line, err := s.hub.renderer.taskSource(path, req.Index)
+	if errors.Is(err, errNoTask) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	content, err := os.ReadFile(file)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	updated, err := setTask(content, line, req.Checked)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if !bytes.Equal(updated, content) {
+		if err := writeFileAtomic(file, updated); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
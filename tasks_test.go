@@ -0,0 +1,61 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTaskSourceCountsIncludedItems(t *testing.T) {
+	dir := t.TempDir()
+	main := filepath.Join(dir, "main.md")
+	inc := filepath.Join(dir, "inc.md")
+	writeFile(t, main, "---\ntitle: x\n---\n- [ ] one\n\n<!-- include: inc.md -->\n\n```\n- [ ] fenced\n```\n- [ ] three\n")
+	writeFile(t, inc, "---\na: b\n---\n- [ ] inc1\n- [ ] inc2\n")
+
+	r := NewRenderer()
+	tests := []struct {
+		index int
+		file  string
+		line  int
+	}{
+		{0, main, 3},
+		{1, inc, 3},
+		{2, inc, 4},
+		{3, main, 10},
+	}
+	for _, tt := range tests {
+		file, line, err := r.taskSource(main, tt.index)
+		if err != nil {
+			t.Fatalf("taskSource(%d): %v", tt.index, err)
+		}
+		if file != tt.file || line != tt.line {
+			t.Errorf("taskSource(%d) = %s:%d, want %s:%d", tt.index, file, line, tt.file, tt.line)
+		}
+	}
+	if _, _, err := r.taskSource(main, 4); err != errNoTask {
+		t.Errorf("taskSource(4) error = %v, want errNoTask", err)
+	}
+}
+
+func TestSetTask(t *testing.T) {
+	content := []byte("- [ ] a\n- [x] b\n")
+	got, err := setTask(content, 0, true)
+	if err != nil || string(got) != "- [x] a\n- [x] b\n" {
+		t.Errorf("setTask(0, true) = %q, %v", got, err)
+	}
+	got, err = setTask(content, 1, false)
+	if err != nil || string(got) != "- [ ] a\n- [ ] b\n" {
+		t.Errorf("setTask(1, false) = %q, %v", got, err)
+	}
+	if _, err := setTask([]byte("text\n"), 0, true); err != errNoTask {
+		t.Errorf("setTask on a plain line: error = %v, want errNoTask", err)
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// selfSignedCertificate creates a throwaway certificate for --tls-self-signed,
+// valid for localhost, this machine's hostname and its network addresses. It
+// lives only as long as the process, so browsers warn about it every time.
+func selfSignedCertificate() (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "livemd", Organization: []string{"livemd (self-signed)"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(0, 0, 30),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	if host, err := os.Hostname(); err == nil && host != "" {
+		template.DNSNames = append(template.DNSNames, host)
+	}
+	for _, addr := range getNetworkAddresses() {
+		if ip := net.ParseIP(addr); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
+
+// daemonClient is what the CLI talks to the local daemon with. A daemon on
+// localhost or a --socket is trusted without checking its certificate: with
+// --tls-self-signed (or a certificate issued for the machine's public name)
+// verification would always fail. One bound to another address (--bind) is
+// verified like any server, so LIVEMD_AUTH, which supplies the credentials
+// of a daemon started with --auth, isn't sent to whoever answers there.
+var daemonClient = &http.Client{
+	Transport: authTransport{daemonTransport{
+		local: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			DialContext:     dialDaemon,
+		},
+		remote: &http.Transport{DialContext: dialDaemon},
+	}},
+}
+
+// daemonTransport sends requests to a daemon on this machine through local
+// and to any other through remote.
+type daemonTransport struct {
+	local, remote http.RoundTripper
+}
+
+func (t daemonTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if lockSocket() != "" || isLoopbackHost(r.URL.Hostname()) {
+		return t.local.RoundTrip(r)
+	}
+	return t.remote.RoundTrip(r)
+}
+
+// isLoopbackHost reports whether host, a URL host without the port, names
+// this machine's loopback interface.
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// dialDaemon connects to the daemon at addr, or to its Unix socket instead
+// if the lock file names one (--socket).
+func dialDaemon(ctx context.Context, network, addr string) (net.Conn, error) {
+	var d net.Dialer
+	if socket := lockSocket(); socket != "" {
+		return d.DialContext(ctx, "unix", socket)
+	}
+	return d.DialContext(ctx, network, addr)
+}
+
+// daemonURL is the URL of path on the daemon running at port, over https if
+// the lock file says it was started with TLS.
+func daemonURL(port int, path string) string {
+	return fmt.Sprintf("%s://%s%s", lockScheme(), daemonAddr(port), path)
+}
+
+// daemonAddr is the host:port the daemon running at port accepts
+// connections on: localhost, unless the lock file names its --bind address.
+// Behind a --socket it is just "localhost", for the Host header.
+func daemonAddr(port int) string {
+	if lockSocket() != "" {
+		return "localhost"
+	}
+	host := lockHost()
+	if host == "" {
+		host = "localhost"
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"html"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// tocEntry is one heading listed in a table of contents.
+type tocEntry struct {
+	level int
+	id    string
+	text  string
+}
+
+// tocNode is the table of contents block (--toc), placed at the top of the
+// document by tocTransformer and written out by tocRenderer.
+type tocNode struct {
+	ast.BaseBlock
+	entries []tocEntry
+}
+
+var kindTOC = ast.NewNodeKind("TOC")
+
+func (n *tocNode) Kind() ast.NodeKind { return kindTOC }
+
+func (n *tocNode) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, nil, nil)
+}
+
+// tocTransformer collects the headings down to depth, with the ids
+// parser.WithAutoHeadingID gave them, into a tocNode before the first block.
+// Documents without such headings get none.
+type tocTransformer struct {
+	depth int
+}
+
+func (t *tocTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+	var entries []tocEntry
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		heading, ok := n.(*ast.Heading)
+		if !entering || !ok {
+			return ast.WalkContinue, nil
+		}
+		if heading.Level <= t.depth {
+			id, _ := heading.AttributeString("id")
+			idBytes, _ := id.([]byte)
+			entries = append(entries, tocEntry{
+				level: heading.Level,
+				id:    string(idBytes),
+				text:  string(heading.Text(source)),
+			})
+		}
+		return ast.WalkSkipChildren, nil
+	})
+	if len(entries) == 0 {
+		return
+	}
+	doc.InsertBefore(doc, doc.FirstChild(), &tocNode{entries: entries})
+}
+
+// tocRenderer writes a tocNode as <nav class="toc"> with one nested <ul> per
+// heading level. A heading shallower than the one that opened the list
+// closes nested lists back to its own level, but not past the first.
+type tocRenderer struct{}
+
+func (r *tocRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindTOC, r.render)
+}
+
+func (r *tocRenderer) render(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	w.WriteString("<nav class=\"toc\">\n")
+	var open []int // levels of the open lists, innermost last
+	for _, e := range node.(*tocNode).entries {
+		switch {
+		case len(open) == 0 || e.level > open[len(open)-1]:
+			w.WriteString("<ul>\n<li>")
+			open = append(open, e.level)
+		default:
+			for len(open) > 1 && e.level < open[len(open)-1] {
+				w.WriteString("</li>\n</ul>\n")
+				open = open[:len(open)-1]
+			}
+			w.WriteString("</li>\n<li>")
+		}
+		w.WriteString("<a href=\"#" + html.EscapeString(e.id) + "\">" + html.EscapeString(e.text) + "</a>")
+	}
+	for range open {
+		w.WriteString("</li>\n</ul>\n")
+	}
+	w.WriteString("</nav>\n")
+	return ast.WalkSkipChildren, nil
+}
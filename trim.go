@@ -0,0 +1,174 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// blockTags are elements whose surrounding whitespace never renders, so
+// trimHTML may drop it entirely. Around inline elements a space is kept.
+var blockTags = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true,
+	"br": true, "dd": true, "details": true, "div": true, "dl": true,
+	"dt": true, "figcaption": true, "figure": true, "footer": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"header": true, "hr": true, "li": true, "main": true, "nav": true,
+	"ol": true, "p": true, "pre": true, "section": true, "summary": true,
+	"table": true, "tbody": true, "td": true, "tfoot": true, "th": true,
+	"thead": true, "tr": true, "ul": true,
+}
+
+// verbatimTags keep their content byte for byte: whitespace is significant
+// in pre/textarea, and script/style are not HTML.
+var verbatimTags = map[string]bool{"pre": true, "textarea": true, "script": true, "style": true}
+
+var (
+	tagNamePattern     = regexp.MustCompile(`^</?([A-Za-z][A-Za-z0-9-]*)`)
+	quotedValuePattern = regexp.MustCompile(`(\s[A-Za-z_:][A-Za-z0-9_:.-]*)="([A-Za-z0-9_.:-]+)"`)
+	mermaidTagPattern  = regexp.MustCompile(`\sclass="[^"]*\bmermaid\b`)
+	whitespacePattern  = regexp.MustCompile(`\s+`)
+)
+
+// htmlToken is a tag, comment or run of text in trimHTML's input.
+type htmlToken struct {
+	text  string
+	isTag bool
+	name  string // lowercase tag name, for tags
+}
+
+// trimHTML is a small, conservative minifier for --trim-html. It drops
+// comments (except IE conditional comments), collapses whitespace, removes
+// whitespace next to block elements and unquotes attribute values that don't
+// need quotes. <pre>, <textarea>, <script>, <style> and mermaid diagram
+// sources are copied unchanged.
+func trimHTML(s string) string {
+	tokens := tokenizeHTML(s)
+	var b strings.Builder
+	b.Grow(len(s))
+	for i, tok := range tokens {
+		if tok.isTag {
+			b.WriteString(tok.text)
+			continue
+		}
+		if tok.name == "verbatim" {
+			b.WriteString(tok.text)
+			continue
+		}
+		text := whitespacePattern.ReplaceAllString(tok.text, " ")
+		if i == 0 || (tokens[i-1].isTag && blockTags[tokens[i-1].name]) {
+			text = strings.TrimLeft(text, " ")
+		}
+		if i == len(tokens)-1 || (tokens[i+1].isTag && blockTags[tokens[i+1].name]) {
+			text = strings.TrimRight(text, " ")
+		}
+		b.WriteString(text)
+	}
+	return b.String()
+}
+
+// tokenizeHTML splits s into tags and text, dropping comments and shrinking
+// attributes. Contents of verbatim elements come back as a single text token
+// named "verbatim".
+func tokenizeHTML(s string) []htmlToken {
+	var tokens []htmlToken
+	for len(s) > 0 {
+		lt := strings.IndexByte(s, '<')
+		if lt < 0 {
+			tokens = appendText(tokens, s)
+			break
+		}
+		if lt > 0 {
+			tokens = appendText(tokens, s[:lt])
+			s = s[lt:]
+		}
+
+		if strings.HasPrefix(s, "<!--") {
+			end := strings.Index(s, "-->")
+			if end < 0 {
+				end = len(s) - 3
+			}
+			if strings.HasPrefix(s, "<!--[if") {
+				tokens = append(tokens, htmlToken{text: s[:end+3], isTag: true})
+			}
+			s = s[end+3:]
+			continue
+		}
+
+		m := tagNamePattern.FindStringSubmatch(s)
+		if m == nil {
+			// A lone '<' in text.
+			tokens = appendText(tokens, "<")
+			s = s[1:]
+			continue
+		}
+		end := tagEnd(s)
+		tag, name := s[:end], strings.ToLower(m[1])
+		s = s[end:]
+
+		closing := strings.HasPrefix(tag, "</")
+		verbatim := !closing && (verbatimTags[name] || (name == "div" && mermaidTagPattern.MatchString(tag)))
+		if !closing && !verbatim {
+			tag = unquoteAttributes(tag)
+		}
+		tokens = append(tokens, htmlToken{text: tag, isTag: true, name: name})
+
+		if verbatim {
+			closeIdx := strings.Index(strings.ToLower(s), "</"+name)
+			if closeIdx < 0 {
+				closeIdx = len(s)
+			}
+			tokens = append(tokens, htmlToken{text: s[:closeIdx], name: "verbatim"})
+			s = s[closeIdx:]
+		}
+	}
+	return tokens
+}
+
+// unquoteAttributes drops the quotes around attribute values in tag that
+// don't need them. A value right before the "/" of "/>" keeps its quotes, as
+// alt=x/> would read as "x/".
+func unquoteAttributes(tag string) string {
+	var b strings.Builder
+	last := 0
+	for _, m := range quotedValuePattern.FindAllStringSubmatchIndex(tag, -1) {
+		if strings.HasPrefix(tag[m[1]:], "/") {
+			continue
+		}
+		b.WriteString(tag[last:m[0]])
+		b.WriteString(tag[m[2]:m[3]])
+		b.WriteByte('=')
+		b.WriteString(tag[m[4]:m[5]])
+		last = m[1]
+	}
+	b.WriteString(tag[last:])
+	return b.String()
+}
+
+// appendText adds text to tokens, merging it into a preceding text token so
+// the text on both sides of a dropped comment collapses as one run.
+func appendText(tokens []htmlToken, text string) []htmlToken {
+	if n := len(tokens); n > 0 && !tokens[n-1].isTag && tokens[n-1].name == "" {
+		tokens[n-1].text += text
+		return tokens
+	}
+	return append(tokens, htmlToken{text: text})
+}
+
+// tagEnd returns the index just past the '>' closing the tag at the start of
+// s, skipping quoted attribute values.
+func tagEnd(s string) int {
+	var quote byte
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '>':
+			return i + 1
+		}
+	}
+	return len(s)
+}
@@ -0,0 +1,25 @@
+package main
+
+import "testing"
+
+func TestTrimHTML(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"unquotes values", `<a href="x.md" class="link">x</a>`, `<a href=x.md class=link>x</a>`},
+		{"keeps quotes that are needed", `<a title="two words">x</a>`, `<a title="two words">x</a>`},
+		{"self-closing tag", `<img src="a.png" alt="x"/>`, `<img src=a.png alt="x"/>`},
+		{"self-closing tag with a space", `<img src="a.png" alt="x" />`, `<img src=a.png alt=x />`},
+		{"drops comments", "<p>a <!-- note --> b</p>", "<p>a b</p>"},
+		{"keeps conditional comments", "<!--[if IE]><p>old</p><![endif]-->", "<!--[if IE]><p>old</p><![endif]-->"},
+		{"whitespace around blocks", "<ul>\n  <li> one </li>\n</ul>\n", "<ul><li>one</li></ul>"},
+		{"space between inline elements", "<p><em>a</em>\n  <b>b</b></p>", "<p><em>a</em> <b>b</b></p>"},
+		{"pre is verbatim", "<pre class=\"x\"><code>a  <!-- b -->\n  c=\"d\"</code></pre>", "<pre class=\"x\"><code>a  <!-- b -->\n  c=\"d\"</code></pre>"},
+		{"mermaid source is verbatim", "<div class=\"mermaid\">a -->  b\n</div>", "<div class=\"mermaid\">a -->  b\n</div>"},
+	}
+	for _, tt := range tests {
+		if got := trimHTML(tt.in); got != tt.want {
+			t.Errorf("%s: trimHTML(%q) = %q, want %q", tt.name, tt.in, got, tt.want)
+		}
+	}
+}
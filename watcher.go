@@ -1,47 +1,120 @@
 package main
 
 import (
-	"log"
+	"errors"
+	"log/slog"
 	"os"
+	"path/filepath"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
 )
 
+// FileWatcher reports changes to a single file. Watcher (fsnotify) is the
+// default; PollingWatcher covers filesystems that don't deliver events.
+type FileWatcher interface {
+	Watch(filepath string, onChange func(), onDelete func()) error
+	WatchedPaths() []string
+	Close() error
+}
+
+// pollInterval is how often a PollingWatcher stats its file, unless
+// --poll-interval says otherwise.
+const pollInterval = 500 * time.Millisecond
+
+// defaultDebounce is how long a Watcher waits for writes to settle before
+// reporting a change, unless --debounce says otherwise.
+const defaultDebounce = 100 * time.Millisecond
+
+// renameWait is how long a Watcher waits for a file to reappear at its path
+// after being renamed away, as editors that save by renaming a temp file over
+// the original do, before treating it as deleted.
+const renameWait = 500 * time.Millisecond
+
+// retryWatchDelay is how long a Watcher waits before recreating its fsnotify
+// watcher after too many consecutive errors.
+const retryWatchDelay = time.Second
+
 // Watcher watches a file for changes with debouncing
 type Watcher struct {
 	watcher *fsnotify.Watcher
 	done    chan struct{}
 	mu      sync.Mutex
 	timer   *time.Timer
+	paths   map[string]bool // what watcher is subscribed to, for WatchedPaths
+
+	// debounceDelay is how long to wait after the last event before calling
+	// onChange (--debounce).
+	debounceDelay time.Duration
+
+	// RetryAfter is the number of consecutive errors after which the fsnotify
+	// watcher is recreated (--retry-watch); 0 never retries. OnFail is called
+	// if recreating it fails, after which the file is no longer watched.
+	RetryAfter int
+	OnFail     func(error)
+
+	// AddTimeout bounds each fsnotify Add (--watch-timeout), which can block
+	// forever on an unresponsive network filesystem; 0 = no limit.
+	AddTimeout time.Duration
+
+	// WatchParent also watches the file's directory (--watch-parent-dir), so
+	// a file recreated under a new inode (e.g. by vim's backup copy) is
+	// picked up from its Create event.
+	WatchParent bool
+
+	// WatchSymlinks polls how the file's path resolves when it goes through
+	// a symlink (--watch-symlinks), and moves the watch over when the link is
+	// repointed, e.g. by "ln -sfn v2 docs/current".
+	WatchSymlinks bool
 }
 
-func NewWatcher() *Watcher {
+// errWatchTimeout is returned by Watcher.Watch when subscribing to the file
+// took longer than AddTimeout.
+var errWatchTimeout = errors.New("timed out subscribing to file changes")
+
+func NewWatcher(debounce time.Duration) *Watcher {
 	return &Watcher{
-		done: make(chan struct{}),
+		done:          make(chan struct{}),
+		paths:         make(map[string]bool),
+		debounceDelay: debounce,
 	}
 }
 
 func (w *Watcher) Watch(filepath string, onChange func(), onDelete func()) error {
-	watcher, err := fsnotify.NewWatcher()
+	watcher, err := w.notifier(filepath)
 	if err != nil {
 		return err
 	}
+	w.mu.Lock()
 	w.watcher = watcher
+	w.mu.Unlock()
 
-	if err := watcher.Add(filepath); err != nil {
-		watcher.Close()
-		return err
+	if w.WatchSymlinks {
+		if target, ok := symlinkTarget(filepath); ok {
+			go w.followSymlink(filepath, target, onChange)
+		}
 	}
 
 	go func() {
+		errorCount := 0
 		for {
 			select {
 			case event, ok := <-watcher.Events:
 				if !ok {
 					return
 				}
+				errorCount = 0
+				if w.WatchParent && !sameFile(event.Name, filepath) {
+					continue // another entry of the parent directory
+				}
+
+				// The file was recreated (--watch-parent-dir): follow the new one.
+				if event.Op&fsnotify.Create == fsnotify.Create {
+					w.readd(watcher, filepath)
+					w.debounce(onChange)
+				}
 
 				// Only react to write events
 				if event.Op&fsnotify.Write == fsnotify.Write {
@@ -54,21 +127,50 @@ func (w *Watcher) Watch(filepath string, onChange func(), onDelete func()) error
 					time.Sleep(300 * time.Millisecond)
 					if _, err := os.Stat(filepath); os.IsNotExist(err) {
 						// File is truly gone
+						w.mu.Lock()
+						delete(w.paths, filepath)
+						w.mu.Unlock()
 						if onDelete != nil {
 							onDelete()
 						}
 					} else {
 						// File was recreated (editor behavior)
-						watcher.Add(filepath)
+						w.readd(watcher, filepath)
 						w.debounce(onChange)
 					}
 				}
 
+				// Handle the file being moved away. fsnotify drops the watch,
+				// which followed the old file; editors like vim put the new
+				// file in its place right after.
+				if event.Op&fsnotify.Rename == fsnotify.Rename {
+					watcher.Remove(filepath)
+					if awaitFile(filepath, renameWait, w.done) {
+						w.readd(watcher, filepath)
+						w.debounce(onChange)
+					} else {
+						w.mu.Lock()
+						delete(w.paths, filepath)
+						w.mu.Unlock()
+						if onDelete != nil {
+							onDelete()
+						}
+					}
+				}
+
 			case err, ok := <-watcher.Errors:
 				if !ok {
 					return
 				}
-				log.Printf("Watcher error: %v", err)
+				slog.Warn("Watcher error", "file", filepath, "err", err)
+				errorCount++
+				if w.RetryAfter > 0 && errorCount >= w.RetryAfter {
+					watcher = w.restart(filepath, errorCount)
+					if watcher == nil {
+						return
+					}
+					errorCount = 0
+				}
 
 			case <-w.done:
 				return
@@ -79,6 +181,167 @@ func (w *Watcher) Watch(filepath string, onChange func(), onDelete func()) error
 	return nil
 }
 
+// notifier returns an fsnotify watcher for path (and with WatchParent, its
+// directory), recording what it watches for WatchedPaths.
+func (w *Watcher) notifier(path string) (*fsnotify.Watcher, error) {
+	watcher, err := newFileNotifier(path, w.AddTimeout)
+	if err != nil {
+		return nil, err
+	}
+	paths := []string{path}
+	if w.WatchParent {
+		if err := watcher.Add(filepath.Dir(path)); err != nil {
+			watcher.Close()
+			return nil, err
+		}
+		paths = append(paths, filepath.Dir(path))
+	}
+	w.mu.Lock()
+	for _, p := range paths {
+		w.paths[p] = true
+	}
+	w.mu.Unlock()
+	return watcher, nil
+}
+
+// readd subscribes watcher to a recreated file again.
+func (w *Watcher) readd(watcher *fsnotify.Watcher, path string) {
+	if watcher.Add(path) != nil {
+		return
+	}
+	w.mu.Lock()
+	w.paths[path] = true
+	w.mu.Unlock()
+}
+
+// awaitFile reports whether path exists within wait, checking every few
+// milliseconds, or gives up early if done is closed.
+func awaitFile(path string, wait time.Duration, done <-chan struct{}) bool {
+	deadline := time.Now().Add(wait)
+	for {
+		if _, err := os.Stat(path); err == nil {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		select {
+		case <-time.After(25 * time.Millisecond):
+		case <-done:
+			return false
+		}
+	}
+}
+
+// symlinkTarget returns what path resolves to, and whether that differs from
+// path itself because the file or one of its directories is a symlink.
+func symlinkTarget(path string) (string, bool) {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", false
+	}
+	abs, err := filepath.Abs(path)
+	return resolved, err == nil && !PathsEqual(resolved, abs)
+}
+
+// followSymlink re-resolves path every pollInterval. fsnotify watches the
+// file a symlink pointed at when it was added, so when the link is repointed
+// the watch is renewed on the new target and onChange shows its content.
+func (w *Watcher) followSymlink(path, target string, onChange func()) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			resolved, err := filepath.EvalSymlinks(path)
+			if err != nil || resolved == target {
+				continue // dangling links are left to the Remove handling
+			}
+			target = resolved
+			w.mu.Lock()
+			watcher := w.watcher
+			w.mu.Unlock()
+			watcher.Remove(path)
+			if err := watcher.Add(path); err != nil {
+				slog.Warn("Symlink repointed to a file that can't be watched", "file", path, "target", target, "err", err)
+				continue
+			}
+			slog.Info("Symlink repointed", "file", path, "target", target)
+			w.debounce(onChange)
+
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// sameFile reports whether an fsnotify event name refers to path.
+func sameFile(name, path string) bool {
+	return PathsEqual(filepath.Clean(name), filepath.Clean(path))
+}
+
+// newFileNotifier returns an fsnotify watcher subscribed to path, giving up
+// with errWatchTimeout after timeout (if non-zero).
+func newFileNotifier(path string, timeout time.Duration) (*fsnotify.Watcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	added := make(chan error, 1)
+	go func() { added <- watcher.Add(path) }()
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		expired = time.After(timeout)
+	}
+	select {
+	case err := <-added:
+		if err != nil {
+			watcher.Close()
+			return nil, err
+		}
+		return watcher, nil
+	case <-expired:
+		// The Add goroutine stays blocked until the filesystem answers.
+		watcher.Close()
+		return nil, errWatchTimeout
+	}
+}
+
+// restart replaces the fsnotify watcher after errorCount consecutive errors.
+// It returns nil if the Watcher was closed meanwhile or the new watcher could
+// not be created, in which case OnFail has been told.
+func (w *Watcher) restart(path string, errorCount int) *fsnotify.Watcher {
+	slog.Warn("Restarting watcher after consecutive errors", "file", path, "errors", errorCount)
+	w.mu.Lock()
+	w.watcher.Close()
+	w.mu.Unlock()
+
+	select {
+	case <-time.After(retryWatchDelay):
+	case <-w.done:
+		return nil
+	}
+
+	watcher, err := w.notifier(path)
+	if err != nil {
+		if w.OnFail != nil {
+			w.OnFail(err)
+		}
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	select {
+	case <-w.done: // closed while we were recreating it
+		watcher.Close()
+		return nil
+	default:
+	}
+	w.watcher = watcher
+	return watcher
+}
+
 func (w *Watcher) debounce(fn func()) {
 	w.mu.Lock()
 	defer w.mu.Unlock()
@@ -87,13 +350,110 @@ func (w *Watcher) debounce(fn func()) {
 		w.timer.Stop()
 	}
 
-	w.timer = time.AfterFunc(100*time.Millisecond, fn)
+	w.timer = time.AfterFunc(w.debounceDelay, fn)
+}
+
+// WatchedPaths returns the paths the Watcher is subscribed to, sorted: the
+// file, while it exists, and with WatchParent its directory.
+func (w *Watcher) WatchedPaths() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return sortedKeys(w.paths)
 }
 
 func (w *Watcher) Close() error {
 	close(w.done)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.paths = make(map[string]bool)
 	if w.watcher != nil {
 		return w.watcher.Close()
 	}
 	return nil
 }
+
+// PollingWatcher detects changes by stat'ing the file on an interval, for
+// paths where fsnotify gets no events (e.g. UNC shares on Windows, NFS, SMB
+// or WSL1 mounts).
+type PollingWatcher struct {
+	interval time.Duration
+	done     chan struct{}
+
+	mu   sync.Mutex
+	path string // set by Watch
+}
+
+func NewPollingWatcher(interval time.Duration) *PollingWatcher {
+	return &PollingWatcher{
+		interval: interval,
+		done:     make(chan struct{}),
+	}
+}
+
+func (w *PollingWatcher) Watch(filepath string, onChange func(), onDelete func()) error {
+	info, err := os.Stat(filepath)
+	if err != nil {
+		return err
+	}
+	modTime, size := info.ModTime(), info.Size()
+	w.mu.Lock()
+	w.path = filepath
+	w.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+		deleted := false
+		for {
+			select {
+			case <-ticker.C:
+				info, err := os.Stat(filepath)
+				if err != nil {
+					if os.IsNotExist(err) && !deleted {
+						deleted = true
+						if onDelete != nil {
+							onDelete()
+						}
+					}
+					continue
+				}
+				if deleted || !info.ModTime().Equal(modTime) || info.Size() != size {
+					deleted = false
+					modTime, size = info.ModTime(), info.Size()
+					onChange()
+				}
+
+			case <-w.done:
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// WatchedPaths returns the polled file. Polling keeps going while the file
+// is deleted, since that's how it notices it come back.
+func (w *PollingWatcher) WatchedPaths() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.path == "" {
+		return nil
+	}
+	return []string{w.path}
+}
+
+func (w *PollingWatcher) Close() error {
+	close(w.done)
+	return nil
+}
+
+// sortedKeys returns the keys of set in order.
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
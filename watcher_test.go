@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestWatcherFollowsRenameOverPath saves the way editors that write a temp
+// file and rename it into place do: the watched file is renamed away and a
+// new one appears at its path. That is a change, not a deletion, and the new
+// file is watched from then on.
+func TestWatcherFollowsRenameOverPath(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "doc.md")
+	writeFile(t, path, "one\n")
+
+	changes := make(chan struct{}, 16)
+	deletes := make(chan struct{}, 16)
+	w := NewWatcher(20 * time.Millisecond)
+	defer w.Close()
+	err := w.Watch(path,
+		func() { changes <- struct{}{} },
+		func() { deletes <- struct{}{} })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Rename(path, filepath.Join(dir, "doc.md~")); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, path, "two\n")
+	expectEvent(t, changes, deletes, "the rename")
+
+	// Later writes go to the new file, which must still be watched.
+	for _, content := range []string{"three\n", "four\n"} {
+		writeFile(t, path, content)
+		expectEvent(t, changes, deletes, "a write after the rename")
+	}
+}
+
+// expectEvent waits for a change and fails t on a deletion or no event.
+func expectEvent(t *testing.T, changes, deletes chan struct{}, what string) {
+	t.Helper()
+	select {
+	case <-changes:
+	case <-deletes:
+		t.Fatalf("%s was reported as a deletion", what)
+	case <-time.After(renameWait + 2*time.Second):
+		t.Fatalf("%s was never reported", what)
+	}
+	// Let the debounce settle so one save isn't counted twice.
+	time.Sleep(100 * time.Millisecond)
+	for len(changes) > 0 {
+		<-changes
+	}
+}
+
+func TestWatcherFailureShownInBrowser(t *testing.T) {
+	s := newTestServer(t, testOptions())
+	path := filepath.Join(t.TempDir(), "doc.md")
+	writeFile(t, path, "# Doc\n")
+	if err := s.hub.AddFile(path); err != nil {
+		t.Fatal(err)
+	}
+	w, ok := s.hub.newFileWatcher(path).(*Watcher)
+	if !ok {
+		t.Fatal("newFileWatcher didn't return an fsnotify Watcher")
+	}
+	defer w.Close()
+	w.OnFail(errors.New("too many open files"))
+
+	files := s.hub.GetFiles()
+	if !strings.Contains(files[0].HTML, "Watcher failed permanently: too many open files") {
+		t.Errorf("file HTML after a watcher failure = %q", files[0].HTML)
+	}
+}
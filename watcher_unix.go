@@ -0,0 +1,9 @@
+//go:build !windows
+
+package main
+
+// isNetworkDrive is always false off Windows: fsnotify's inotify/kqueue
+// backends are used for every path there.
+func isNetworkDrive(path string) bool {
+	return false
+}
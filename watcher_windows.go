@@ -0,0 +1,36 @@
+//go:build windows
+
+package main
+
+import (
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/windows"
+)
+
+// isNetworkDrive reports whether path lives on a network share, where
+// ReadDirectoryChangesW (fsnotify's backend) doesn't deliver events: UNC
+// paths (\\server\share\...) and drive letters mapped to a share.
+func isNetworkDrive(path string) bool {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	if strings.HasPrefix(abs, `\\?\UNC\`) {
+		return true
+	}
+	if strings.HasPrefix(abs, `\\`) && !strings.HasPrefix(abs, `\\?\`) && !strings.HasPrefix(abs, `\\.\`) {
+		return true
+	}
+
+	root := filepath.VolumeName(abs)
+	if root == "" {
+		return false
+	}
+	rootPtr, err := windows.UTF16PtrFromString(root + `\`)
+	if err != nil {
+		return false
+	}
+	return windows.GetDriveType(rootPtr) == windows.DRIVE_REMOTE
+}